@@ -1,19 +1,24 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/CodeZeroSugar/internal/headers"
 	"github.com/CodeZeroSugar/internal/request"
 	"github.com/CodeZeroSugar/internal/response"
+	"github.com/CodeZeroSugar/internal/router"
 	"github.com/CodeZeroSugar/internal/server"
 )
 
@@ -48,31 +53,38 @@ const internalErrorHTML = `<html>
 </html>`
 
 const (
-	port = 42069
+	port            = 42069
+	shutdownTimeout = 10 * time.Second
 )
 
 const (
-	binURL   = "https://httpbin.org/"
+	binHost  = "httpbin.org"
 	xContent = "X-Content-Sha256"
 	xLength  = "X-Content-Length"
 )
 
 func handleHTTPBinProxy(w *response.Writer, req *request.Request) {
-	path := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	fullURL := binURL + path
+	upstream := url.URL{
+		Scheme:   "https",
+		Host:     binHost,
+		Path:     "/" + req.PathValue("path"),
+		RawQuery: req.Target.RawQuery,
+	}
 	h := response.GetDefaultHeaders(0)
 	h.Set("Transfer-Encoding", "chunked")
 	h.Set("Trailer", xContent+", "+xLength)
-	h.Del("Content-length")
+	h.Del("Content-Length")
 
-	resp, err := http.Get(fullURL)
+	resp, err := http.Get(upstream.String())
 	if err != nil {
 		log.Printf("failed to GET response from httpbin: %s", err)
+		w.SetStatus(response.StatusCodeBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	if err = w.WriteStatusLine(response.StatusCode(resp.StatusCode)); err != nil {
+	reason := strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" ")
+	if err = w.WriteStatusLineReason(response.StatusCode(resp.StatusCode), reason); err != nil {
 		log.Printf("failed to write status line: %s", err)
 	}
 	if err = w.WriteHeaders(h); err != nil {
@@ -91,6 +103,10 @@ func handleHTTPBinProxy(w *response.Writer, req *request.Request) {
 				log.Printf("failed to write chunked body: %s", err)
 				break
 			}
+			if err = w.Flush(); err != nil {
+				log.Printf("failed to flush chunked body: %s", err)
+				break
+			}
 		}
 		if err == io.EOF {
 			break
@@ -135,68 +151,77 @@ func handleVideo(w *response.Writer, req *request.Request) {
 	}
 }
 
-func handler(w *response.Writer, req *request.Request) {
-	path := req.RequestLine.RequestTarget
-	if path == "/" {
-		body := []byte(okHTML)
-		h := response.GetDefaultHeaders(len(body))
-		h["Content-Type"] = "text/html"
-		if err := w.WriteStatusLine(response.StatusCodeOK); err != nil {
-			log.Printf("handler failed to write status line: %s", err)
-		}
-		if err := w.WriteHeaders(h); err != nil {
-			log.Printf("handler failed to write headers: %s", err)
-		}
-		if _, err := w.WriteBody(body); err != nil {
-			log.Printf("handler failed to write body: %s", err)
-		}
-	}
-	if path == "/yourproblem" {
-		body := []byte(badRequestHTML)
-		h := response.GetDefaultHeaders(len(body))
-		h["Content-Type"] = "text/html"
-		if err := w.WriteStatusLine(response.StatusCodeBadRequest); err != nil {
-			log.Printf("handler failed to write status line: %s", err)
-		}
-		if err := w.WriteHeaders(h); err != nil {
-			log.Printf("handler failed to write headers: %s", err)
-		}
-		if _, err := w.WriteBody(body); err != nil {
-			log.Printf("handler failed to write body: %s", err)
-		}
-	}
-	if path == "/myproblem" {
-		body := []byte(internalErrorHTML)
-		h := response.GetDefaultHeaders(len(body))
-		h["Content-Type"] = "text/html"
-		if err := w.WriteStatusLine(response.StatusCodeInternalServerError); err != nil {
-			log.Printf("handler failed to write status line: %s", err)
-		}
-		if err := w.WriteHeaders(h); err != nil {
-			log.Printf("handler failed to write headers: %s", err)
-		}
-		if _, err := w.WriteBody(body); err != nil {
-			log.Printf("handler failed to write body: %s", err)
-		}
+func writeHTML(w *response.Writer, statusCode response.StatusCode, body string) {
+	w.SetStatus(statusCode)
+	w.Header().Set("Content-Type", "text/html")
+	if _, err := io.WriteString(w, body); err != nil {
+		log.Printf("handler failed to write body: %s", err)
 	}
-	if strings.HasPrefix(path, "/httpbin/") {
-		handleHTTPBinProxy(w, req)
+}
+
+// logRequests logs the method, target, status and body size of every request.
+func logRequests(next server.Handler) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+		log.Printf("%s %s %d %dB %s", req.RequestLine.Method, req.RequestLine.RequestTarget,
+			w.Status(), w.BytesWritten(), time.Since(start))
 	}
-	if path == "/video" {
-		handleVideo(w, req)
+}
+
+func newRouter() *router.Router {
+	r := router.New()
+	r.Use(logRequests)
+	r.Handle("GET", "/", func(w *response.Writer, req *request.Request) {
+		writeHTML(w, response.StatusCodeOK, okHTML)
+	})
+	r.Handle("GET", "/yourproblem", func(w *response.Writer, req *request.Request) {
+		writeHTML(w, response.StatusCodeBadRequest, badRequestHTML)
+	})
+	r.Handle("GET", "/myproblem", func(w *response.Writer, req *request.Request) {
+		writeHTML(w, response.StatusCodeInternalServerError, internalErrorHTML)
+	})
+	r.Handle("GET", "/httpbin/{path...}", handleHTTPBinProxy)
+	r.Handle("GET", "/video", handleVideo)
+	return r
+}
+
+func errorHandler(w *response.Writer, statusCode response.StatusCode, err error) {
+	switch statusCode {
+	case response.StatusCodeBadRequest:
+		writeHTML(w, statusCode, badRequestHTML)
+	case response.StatusCodeInternalServerError:
+		writeHTML(w, statusCode, internalErrorHTML)
+	default:
+		server.DefaultErrorHandler(w, statusCode, err)
 	}
 }
 
 func main() {
-	srv, err := server.Serve(port, handler)
+	srv, err := server.Serve(port, newRouter().Handler(),
+		server.WithErrorHandler(errorHandler),
+		server.WithServerHeader("httpfromtcp"),
+		server.WithTimeouts(server.Timeouts{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		}),
+	)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer srv.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	log.Println("Shutting down, waiting for active requests")
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatalf("Error stopping server: %v", err)
+	}
 	log.Println("Server gracefully stopped")
 }
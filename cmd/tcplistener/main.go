@@ -38,14 +38,22 @@ func main() {
 		fmt.Printf("- Target: %s\n", target)
 		fmt.Printf("- Version: %s\n", version)
 		fmt.Println("Headers:")
-		for key, value := range headers {
+		for key, value := range headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
-		fmt.Println("Body:")
-		for _, body := range req.Body {
-			fmt.Printf("%s", string(body))
+		body, err := req.BodyBytes()
+		if err != nil {
+			log.Fatalf("failed to read request body: %s", err)
 		}
+		fmt.Println("Body:")
+		fmt.Printf("%s", string(body))
 		fmt.Println("")
+		if req.Trailers.Len() > 0 {
+			fmt.Println("Trailers:")
+			for key, value := range req.Trailers.All() {
+				fmt.Printf("- %s: %s\n", key, value)
+			}
+		}
 
 	}
 }
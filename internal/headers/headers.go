@@ -3,89 +3,329 @@ package headers
 import (
 	"bytes"
 	"errors"
-	"regexp"
+	"fmt"
+	"iter"
+	"slices"
 	"strings"
-	"unicode"
 )
 
-var validFieldName = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+\-.^_` + "`" + `|~]+$`)
+var crlf = []byte("\r\n")
 
-func validateFieldName(fieldName string) error {
-	if !validFieldName.MatchString(fieldName) {
-		return errors.New("malformed data, invalid character found in field name")
+// Errors returned by Parse. They are wrapped with details about the offending
+// field line, so compare them with errors.Is.
+var (
+	ErrMalformedFieldLine = errors.New("malformed field line")
+	ErrInvalidFieldName   = errors.New("invalid field name")
+	ErrInvalidFieldValue  = errors.New("invalid field value")
+	ErrObsoleteLineFold   = errors.New("obsolete line folding")
+)
+
+// tokenChars marks the bytes allowed in a token (RFC 9110 §5.6.2), which is
+// what a field name is made of.
+var tokenChars = func() (t [256]bool) {
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+		t[c-'a'+'A'] = true
+	}
+	for _, c := range "!#$%&'*+-.^_`|~" {
+		t[c] = true
+	}
+	return t
+}()
+
+func validFieldName[T string | []byte](fieldName T) bool {
+	if len(fieldName) == 0 {
+		return false
+	}
+	for i := 0; i < len(fieldName); i++ {
+		if !tokenChars[fieldName[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+func validateFieldName[T string | []byte](fieldName T) error {
+	if !validFieldName(fieldName) {
+		return fmt.Errorf("malformed data, invalid character found in field name '%s': %w", fieldName, ErrInvalidFieldName)
+	}
+	return nil
+}
+
+// validateFieldValue rejects the bytes that could end a field line early or
+// be read as one by another parser.
+func validateFieldValue[T string | []byte](fieldValue T) error {
+	for i := 0; i < len(fieldValue); i++ {
+		if c := fieldValue[i]; c == '\r' || c == '\n' || c == 0 {
+			return fmt.Errorf("malformed data, CR, LF or NUL found in field value: %w", ErrInvalidFieldValue)
+		}
 	}
 	return nil
 }
 
-type Headers map[string]string
+// commonFieldNames interns frequently sent field names, in both their
+// canonical and lowercased spellings, so parsing them does not allocate.
+var commonFieldNames = func() map[string]string {
+	names := []string{
+		"Accept", "Accept-Charset", "Accept-Encoding", "Accept-Language",
+		"Authorization", "Cache-Control", "Connection", "Content-Encoding",
+		"Content-Length", "Content-Type", "Cookie", "Date", "Dnt", "Expect",
+		"Forwarded", "Host", "If-Match", "If-Modified-Since", "If-None-Match",
+		"If-Unmodified-Since", "Keep-Alive", "Origin", "Pragma", "Priority",
+		"Range", "Referer", "Sec-Ch-Ua", "Sec-Ch-Ua-Mobile", "Sec-Ch-Ua-Platform",
+		"Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User",
+		"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+		"Upgrade-Insecure-Requests", "User-Agent", "Via", "X-Forwarded-For",
+		"X-Forwarded-Host", "X-Forwarded-Proto", "X-Request-Id",
+	}
+	m := make(map[string]string, 2*len(names))
+	for _, name := range names {
+		m[name] = name
+		lower := strings.ToLower(name)
+		m[lower] = lower
+	}
+	return m
+}()
+
+// internFieldName returns fieldName as a string, spelled as it was received.
+func internFieldName(fieldName []byte) string {
+	if name, ok := commonFieldNames[string(fieldName)]; ok {
+		return name
+	}
+	return string(fieldName)
+}
+
+// CanonicalKey returns the canonical form of a field name: the first letter
+// and every letter following a hyphen are upper case, the rest lower case, so
+// "content-type" becomes "Content-Type". Names that are not valid tokens are
+// returned unchanged.
+func CanonicalKey(key string) string {
+	upper := true
+	canonical := true
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !tokenChars[c] {
+			return key
+		}
+		if (upper && 'a' <= c && c <= 'z') || (!upper && 'A' <= c && c <= 'Z') {
+			canonical = false
+		}
+		upper = c == '-'
+	}
+	if canonical {
+		return key
+	}
+	b := []byte(key)
+	upper = true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		} else if !upper && 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
+
+// trimHostValue strips whitespace around every ':' in a Host value, so
+// "localhost : 42069" reads as "localhost:42069". Other values are left alone,
+// since a ':' in them is data, as in structured field byte sequences.
+func trimHostValue(fieldValue []byte) []byte {
+	padded := false
+	for i, c := range fieldValue {
+		if c != ':' {
+			continue
+		}
+		if (i > 0 && isSpace(fieldValue[i-1])) || (i+1 < len(fieldValue) && isSpace(fieldValue[i+1])) {
+			padded = true
+			break
+		}
+	}
+	if !padded {
+		return fieldValue
+	}
+	trimmed := make([]byte, 0, len(fieldValue))
+	for i, part := range bytes.Split(fieldValue, []byte(":")) {
+		if i > 0 {
+			trimmed = append(trimmed, ':')
+		}
+		trimmed = append(trimmed, bytes.Trim(part, " \t")...)
+	}
+	return trimmed
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Field is a single field line.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Headers holds the field lines of a header or trailer section in the order
+// they were received or added, with names spelled as they were sent. Every
+// lookup matches names without regard to case. Repeated fields are kept as
+// separate lines, so fields that cannot be combined, such as Set-Cookie,
+// survive intact.
+type Headers struct {
+	fields []Field
+}
 
 func NewHeaders() Headers {
-	return make(Headers)
+	return Headers{}
 }
 
+// Get returns the values of every field named key, matched without regard to
+// case, combined into one comma-separated value as RFC 9110 §5.3 allows.
 func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	value, exists := h[key]
+	var value string
+	exists := false
+	for _, f := range h.fields {
+		if !strings.EqualFold(f.Name, key) {
+			continue
+		}
+		if exists {
+			value += ", " + f.Value
+		} else {
+			value = f.Value
+			exists = true
+		}
+	}
 	return value, exists
 }
 
-func (h Headers) Set(key, value string) {
-	h[key] = value
+// Values returns the value of every field line named key, matched without
+// regard to case, in order.
+func (h Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
 }
 
-func (h Headers) Del(key string) {
-	delete(h, key)
+// Add appends a field line, keeping any existing lines with the same name.
+func (h *Headers) Add(key, value string) {
+	h.fields = append(h.fields, Field{Name: key, Value: value})
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	if bytes.Index(data, []byte("\r\n")) == 0 {
-		return 2, true, nil
+// Set replaces every field line named key, matched without regard to case,
+// with a single line. The new line takes the position and the name of the
+// first one it replaces.
+func (h *Headers) Set(key, value string) {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			h.fields[i].Value = value
+			h.deleteFrom(i+1, key)
+			return
+		}
 	}
+	h.Add(key, value)
+}
 
-	str := string(data)
+// Del removes every field line named key, matched without regard to case.
+func (h *Headers) Del(key string) {
+	h.deleteFrom(0, key)
+}
 
-	splitNewLine := strings.Split(str, "\r\n")
-	if len(splitNewLine) == 1 {
-		return 0, false, nil
+func (h *Headers) deleteFrom(start int, key string) {
+	kept := h.fields[:start]
+	for _, f := range h.fields[start:] {
+		if !strings.EqualFold(f.Name, key) {
+			kept = append(kept, f)
+		}
 	}
+	clear(h.fields[len(kept):])
+	h.fields = kept
+}
 
-	headerLine := splitNewLine[0]
-
-	splitColon := strings.Split(headerLine, ":")
-	if len(splitColon) == 1 {
-		return 0, false, errors.New("malformed data, could not find ':'")
+// Validate checks every field line against the rules Parse applies to
+// received fields: names must be tokens, and values must not contain CR, LF or
+// NUL. Writing fields that fail it could split the message.
+func (h Headers) Validate() error {
+	for _, f := range h.fields {
+		if err := validateFieldName(f.Name); err != nil {
+			return err
+		}
+		if err := validateFieldValue(f.Value); err != nil {
+			return fmt.Errorf("field '%s': %w", f.Name, err)
+		}
 	}
+	return nil
+}
 
-	n += len(headerLine) + 2
+// Len returns the number of field lines.
+func (h Headers) Len() int {
+	return len(h.fields)
+}
 
-	fieldName := strings.ToLower(strings.TrimLeft(splitColon[0], " "))
-	if len(fieldName) < 1 {
-		return 0, false, errors.New("field name is null")
+// All iterates over every field line in order.
+func (h Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			if !yield(f.Name, f.Value) {
+				return
+			}
+		}
 	}
+}
 
-	if err = validateFieldName(fieldName); err != nil {
-		return 0, false, err
+// Clone returns a copy that can be modified independently of h.
+func (h Headers) Clone() Headers {
+	return Headers{fields: slices.Clone(h.fields)}
+}
+
+// Parse consumes a single field line from data. It reports done, consuming
+// only the CRLF, when data starts with the empty line that ends the section,
+// and returns n == 0 when data does not hold a complete line yet.
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	idx := bytes.Index(data, crlf)
+	if idx == -1 {
+		return 0, false, nil
+	}
+	if idx == 0 {
+		return 2, true, nil
 	}
 
-	runes := []rune(fieldName)
-	if unicode.IsSpace(runes[len(runes)-1]) {
-		return 0, false, errors.New("invalid whitespace found before ':' character")
+	line := data[:idx]
+	if line[0] == ' ' || line[0] == '\t' {
+		return 0, false, fmt.Errorf("field line starts with whitespace: %w", ErrObsoleteLineFold)
 	}
 
-	trimmedValues := make([]string, 0)
+	colon := bytes.IndexByte(line, ':')
+	if colon == -1 {
+		return 0, false, fmt.Errorf("malformed data, could not find ':': %w", ErrMalformedFieldLine)
+	}
 
-	for _, slice := range splitColon[1:] {
-		trimmed := strings.Trim(slice, " ")
-		trimmedValues = append(trimmedValues, trimmed)
+	fieldName := line[:colon]
+	if len(fieldName) < 1 {
+		return 0, false, fmt.Errorf("field name is null: %w", ErrInvalidFieldName)
+	}
+	if last := fieldName[len(fieldName)-1]; last == ' ' || last == '\t' {
+		return 0, false, fmt.Errorf("invalid whitespace found before ':' character: %w", ErrInvalidFieldName)
+	}
+	if err = validateFieldName(fieldName); err != nil {
+		return 0, false, err
 	}
 
-	fieldValue := strings.Join(trimmedValues, ":")
-	_, exists := h[fieldName]
-	if exists {
-		h[fieldName] += ", " + fieldValue
-	} else {
-		h[fieldName] = fieldValue
+	fieldValue := line[colon+1:]
+	if err = validateFieldValue(fieldValue); err != nil {
+		return 0, false, err
 	}
+	fieldValue = bytes.Trim(fieldValue, " \t")
+	if bytes.EqualFold(fieldName, []byte("Host")) {
+		fieldValue = trimHostValue(fieldValue)
+	}
+
+	h.Add(internFieldName(fieldName), string(fieldValue))
 
-	return n, false, nil
+	return idx + 2, false, nil
 }
@@ -2,11 +2,18 @@ package headers
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// get returns the combined value of key, or "" when it is missing.
+func get(h Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 func TestHeaders(t *testing.T) {
 	// Test: Valid single header
 	headers := NewHeaders()
@@ -14,7 +21,7 @@ func TestHeaders(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -24,7 +31,7 @@ func TestHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 39, n)
 	assert.False(t, done)
 
@@ -34,14 +41,14 @@ func TestHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 	data = []byte("Content-Type: application/json; charset-utf-8\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "application/json; charset-utf-8", headers["content-type"])
+	assert.Equal(t, "application/json; charset-utf-8", get(headers, "content-type"))
 	assert.Equal(t, 47, n)
 	assert.False(t, done)
 
@@ -60,21 +67,21 @@ func TestHeaders(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "lane-loves-go", headers["set-person"])
+	assert.Equal(t, "lane-loves-go", get(headers, "set-person"))
 	assert.Equal(t, 27, n)
 	assert.False(t, done)
 	data = []byte("Set-Person: prime-loves-zig\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "lane-loves-go, prime-loves-zig", headers["set-person"])
+	assert.Equal(t, "lane-loves-go, prime-loves-zig", get(headers, "set-person"))
 	assert.Equal(t, 29, n)
 	assert.False(t, done)
 	data = []byte("Set-Person: tj-loves-ocaml\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", headers["set-person"])
+	assert.Equal(t, "lane-loves-go, prime-loves-zig, tj-loves-ocaml", get(headers, "set-person"))
 	assert.Equal(t, 28, n)
 	assert.False(t, done)
 
@@ -83,6 +90,7 @@ func TestHeaders(t *testing.T) {
 	data = []byte("       Host : localhost:42069       \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrObsoleteLineFold)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
 
@@ -91,6 +99,228 @@ func TestHeaders(t *testing.T) {
 	data = []byte("H@st: localhost:42069\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidFieldName)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	data = []byte("Host localhost\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrMalformedFieldLine)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Whitespace before colon
+	headers = NewHeaders()
+	data = []byte("Host : localhost:42069\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidFieldName)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Obsolete line folding
+	headers = NewHeaders()
+	data = []byte(" continued\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrObsoleteLineFold)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Tabs around the value are trimmed
+	headers = NewHeaders()
+	data = []byte("Host:\tlocalhost:42069\t\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
+	assert.Equal(t, 24, n)
+	assert.False(t, done)
+
+	// Test: Bare LF, CR and NUL in values
+	for _, line := range []string{"X-A: a\nX-B: b\r\n\r\n", "X-A: a\rX-B: b\r\n\r\n", "X-A: a\x00b\r\n\r\n"} {
+		headers = NewHeaders()
+		n, done, err = headers.Parse([]byte(line))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrInvalidFieldValue)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+	}
+}
+
+func TestMultiValuedHeaders(t *testing.T) {
+	// Test: Repeated fields are kept as separate lines in order
+	h := NewHeaders()
+	data := []byte("Set-Cookie: a=1\r\nHost: localhost\r\nSet-Cookie: b=2\r\n\r\n")
+	pos := 0
+	for {
+		n, done, err := h.Parse(data[pos:])
+		require.NoError(t, err)
+		pos += n
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, 3, h.Len())
+	assert.Equal(t, []string{"a=1", "b=2"}, h.Values("Set-Cookie"))
+	value, ok := h.Get("set-cookie")
+	assert.True(t, ok)
+	assert.Equal(t, "a=1, b=2", value)
+	var names []string
+	for name := range h.All() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Set-Cookie", "Host", "Set-Cookie"}, names)
+
+	// Test: Set replaces every line in place of the first
+	h = NewHeaders()
+	h.Add("X-A", "1")
+	h.Add("X-B", "2")
+	h.Add("X-A", "3")
+	h.Set("X-A", "4")
+	var fields []string
+	for name, value := range h.All() {
+		fields = append(fields, name+"="+value)
+	}
+	assert.Equal(t, []string{"X-A=4", "X-B=2"}, fields)
+
+	// Test: Del removes every line, Clone is independent
+	clone := h.Clone()
+	h.Del("X-A")
+	assert.Equal(t, 1, h.Len())
+	assert.Nil(t, h.Values("X-A"))
+	assert.Equal(t, []string{"4"}, clone.Values("X-A"))
+
+	// Test: Set and Del match names without regard to case
+	h = NewHeaders()
+	h.Set("Content-Length", "0")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("content-type", "text/plain")
+	h.Set("CONTENT-TYPE", "text/html")
+	h.Del("Content-length")
+	assert.Equal(t, 2, h.Len())
+	assert.Nil(t, h.Values("content-length"))
+	assert.Equal(t, []string{"text/html"}, h.Values("Content-Type"))
+
+	// Test: Validate applies the rules Parse enforces
+	assert.NoError(t, h.Validate())
+	h.Add("X-Echo", "a\r\nb")
+	assert.ErrorIs(t, h.Validate(), ErrInvalidFieldValue)
+	h.Del("X-Echo")
+	h.Add("X Echo", "a")
+	assert.ErrorIs(t, h.Validate(), ErrInvalidFieldName)
+}
+
+func TestCanonicalKey(t *testing.T) {
+	assert.Equal(t, "Content-Type", CanonicalKey("content-type"))
+	assert.Equal(t, "Content-Type", CanonicalKey("CONTENT-TYPE"))
+	assert.Equal(t, "Content-Type", CanonicalKey("Content-Type"))
+	assert.Equal(t, "X-Content-Sha256", CanonicalKey("x-content-sha256"))
+	assert.Equal(t, "Www-Authenticate", CanonicalKey("WWW-Authenticate"))
+	assert.Equal(t, "Te", CanonicalKey("TE"))
+	assert.Equal(t, "bad name", CanonicalKey("bad name"))
+	assert.Equal(t, "", CanonicalKey(""))
+}
+
+func BenchmarkParse(b *testing.B) {
+	data := []byte("Host: localhost:42069\r\n" +
+		"User-Agent: Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36\r\n" +
+		"Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8\r\n" +
+		"Accept-Encoding: gzip, deflate, br, zstd\r\n" +
+		"Accept-Language: en-US,en;q=0.9\r\n" +
+		"Connection: keep-alive\r\n" +
+		"\r\n")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		h := NewHeaders()
+		pos := 0
+		for {
+			n, done, err := h.Parse(data[pos:])
+			if err != nil {
+				b.Fatal(err)
+			}
+			pos += n
+			if done {
+				break
+			}
+		}
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	// Test: Content-Length, repeated identical values are accepted
+	h := NewHeaders()
+	h.Add("Content-Length", "42")
+	h.Add("content-length", "42, 42")
+	n, err := h.ContentLength()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), n)
+
+	// Test: Invalid and missing Content-Length
+	for _, value := range []string{"", "-1", "0x10", "4 2", "42, 43", "42,", "99999999999999999999"} {
+		h = NewHeaders()
+		h.Set("Content-Length", value)
+		_, err = h.ContentLength()
+		assert.ErrorIs(t, err, ErrInvalidFieldValue, value)
+	}
+	_, err = NewHeaders().ContentLength()
+	assert.ErrorIs(t, err, ErrMissingField)
+
+	// Test: Content-Type with parameters
+	h = NewHeaders()
+	h.Set("Content-Type", `Multipart/Form-Data; Boundary="a \"quoted\"; boundary"; charset=UTF-8`)
+	mediaType, params, err := h.ContentType()
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+	assert.Equal(t, map[string]string{"boundary": `a "quoted"; boundary`, "charset": "UTF-8"}, params)
+
+	mediaType, params, err = ParseMediaType("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", mediaType)
+	assert.Nil(t, params)
+
+	// Test: Invalid media types
+	for _, value := range []string{"", "text", "text/", "/plain", "text/plain; charset", "text/plain; charset=",
+		`text/plain; charset="utf-8`, "text/plain; a=1; A=2", "text/plain charset=utf-8"} {
+		_, _, err = ParseMediaType(value)
+		assert.ErrorIs(t, err, ErrInvalidFieldValue, value)
+	}
+
+	// Test: List fields across lines, with quoted commas and empty elements
+	h = NewHeaders()
+	h.Add("Accept-Encoding", "gzip;q=1.0, , br")
+	h.Add("accept-encoding", `x-custom;note="a, b", identity`)
+	assert.Equal(t, []string{"gzip;q=1.0", "br", `x-custom;note="a, b"`, "identity"}, h.List("Accept-Encoding"))
+	assert.True(t, h.HasToken("Accept-Encoding", "GZIP"))
+	assert.True(t, h.HasToken("Accept-Encoding", "x-custom"))
+	assert.False(t, h.HasToken("Accept-Encoding", "deflate"))
+	assert.Nil(t, h.List("Connection"))
+
+	// Test: HTTP-date in all three formats
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, value := range []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	} {
+		got, err := ParseTime(value)
+		require.NoError(t, err, value)
+		assert.True(t, want.Equal(got), value)
+	}
+	_, err = ParseTime("2023-01-01T00:00:00Z")
+	assert.ErrorIs(t, err, ErrInvalidFieldValue)
+
+	// Test: HTTP-date fields round trip
+	h = NewHeaders()
+	h.SetTime("Last-Modified", want.In(time.FixedZone("EST", -5*60*60)))
+	value, _ := h.Get("Last-Modified")
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", value)
+	got, err := h.Time("Last-Modified")
+	require.NoError(t, err)
+	assert.True(t, want.Equal(got))
+	_, err = h.Time("If-Modified-Since")
+	assert.ErrorIs(t, err, ErrMissingField)
 }
@@ -0,0 +1,689 @@
+package headers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidStructuredField is returned when a field value is not a valid
+// Structured Field Value (RFC 8941), or when a value cannot be serialized as
+// one.
+var ErrInvalidStructuredField = errors.New("invalid structured field")
+
+// Token is a Structured Field token, kept apart from string so that the two
+// serialize differently.
+type Token string
+
+// The bare item of an Item is one of: int64 (Integer), float64 (Decimal),
+// string (String), Token, []byte (Byte Sequence) or bool (Boolean).
+
+// Param is a single parameter of an Item or InnerList.
+type Param struct {
+	Key   string
+	Value any
+}
+
+// Params holds parameters in the order they appeared.
+type Params []Param
+
+// Get returns the value of the parameter named key.
+func (p Params) Get(key string) (any, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Member is a member of a List or Dictionary, either an Item or an InnerList.
+type Member interface {
+	member()
+}
+
+// Item is a bare item with its parameters.
+type Item struct {
+	Value  any
+	Params Params
+}
+
+// InnerList is a parenthesized list of Items with its own parameters.
+type InnerList struct {
+	Items  []Item
+	Params Params
+}
+
+func (Item) member()      {}
+func (InnerList) member() {}
+
+// List is a Structured Field List.
+type List []Member
+
+// DictMember is a single entry of a Dictionary.
+type DictMember struct {
+	Key   string
+	Value Member
+}
+
+// Dictionary holds the entries of a Structured Field Dictionary in the order
+// they appeared.
+type Dictionary []DictMember
+
+// Get returns the member named key.
+func (d Dictionary) Get(key string) (Member, bool) {
+	for _, m := range d {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ItemField parses the field named key as an Item. Repeated field lines are
+// combined first, as RFC 8941 §4.2 requires.
+func (h Headers) ItemField(key string) (Item, error) {
+	value, exists := h.Get(key)
+	if !exists {
+		return Item{}, fmt.Errorf("%s: %w", key, ErrMissingField)
+	}
+	return ParseItem(value)
+}
+
+// ListField parses the field named key as a List.
+func (h Headers) ListField(key string) (List, error) {
+	value, exists := h.Get(key)
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", key, ErrMissingField)
+	}
+	return ParseList(value)
+}
+
+// DictionaryField parses the field named key as a Dictionary.
+func (h Headers) DictionaryField(key string) (Dictionary, error) {
+	value, exists := h.Get(key)
+	if !exists {
+		return nil, fmt.Errorf("%s: %w", key, ErrMissingField)
+	}
+	return ParseDictionary(value)
+}
+
+// SetItemField sets the field named key to the serialized item.
+func (h *Headers) SetItemField(key string, item Item) error {
+	value, err := SerializeItem(item)
+	if err != nil {
+		return err
+	}
+	h.Set(key, value)
+	return nil
+}
+
+// SetListField sets the field named key to the serialized list. An empty list
+// is sent by leaving the field out, so the field is removed instead.
+func (h *Headers) SetListField(key string, list List) error {
+	value, err := SerializeList(list)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		h.Del(key)
+		return nil
+	}
+	h.Set(key, value)
+	return nil
+}
+
+// SetDictionaryField sets the field named key to the serialized dictionary,
+// removing the field when the dictionary is empty.
+func (h *Headers) SetDictionaryField(key string, dict Dictionary) error {
+	value, err := SerializeDictionary(dict)
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		h.Del(key)
+		return nil
+	}
+	h.Set(key, value)
+	return nil
+}
+
+// sfParser walks a field value following the parsing algorithms of RFC 8941
+// §4.2.
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) fail(format string, args ...any) error {
+	return fmt.Errorf("%s at offset %d in '%s': %w", fmt.Sprintf(format, args...), p.i, p.s, ErrInvalidStructuredField)
+}
+
+func (p *sfParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skipSP() {
+	for !p.eof() && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for !p.eof() && isSpace(p.s[p.i]) {
+		p.i++
+	}
+}
+
+// ParseItem parses value as a Structured Field Item.
+func ParseItem(value string) (Item, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	item, err := p.parseItem()
+	if err != nil {
+		return Item{}, err
+	}
+	p.skipSP()
+	if !p.eof() {
+		return Item{}, p.fail("unexpected %q after item", p.peek())
+	}
+	return item, nil
+}
+
+// ParseList parses value as a Structured Field List.
+func ParseList(value string) (List, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	var list List
+	for !p.eof() {
+		member, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, member)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// ParseDictionary parses value as a Structured Field Dictionary. A key that
+// appears again replaces the earlier value but keeps its position.
+func ParseDictionary(value string) (Dictionary, error) {
+	p := &sfParser{s: value}
+	p.skipSP()
+	var dict Dictionary
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var member Member
+		if p.peek() == '=' {
+			p.i++
+			member, err = p.parseMember()
+		} else {
+			var params Params
+			params, err = p.parseParams()
+			member = Item{Value: true, Params: params}
+		}
+		if err != nil {
+			return nil, err
+		}
+		dict = setDictMember(dict, key, member)
+		if err := p.nextMember(); err != nil {
+			return nil, err
+		}
+	}
+	return dict, nil
+}
+
+func setDictMember(dict Dictionary, key string, member Member) Dictionary {
+	for i := range dict {
+		if dict[i].Key == key {
+			dict[i].Value = member
+			return dict
+		}
+	}
+	return append(dict, DictMember{Key: key, Value: member})
+}
+
+// nextMember consumes the comma between two members of a List or Dictionary.
+func (p *sfParser) nextMember() error {
+	p.skipOWS()
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != ',' {
+		return p.fail("expected ',' but found %q", p.peek())
+	}
+	p.i++
+	p.skipOWS()
+	if p.eof() {
+		return p.fail("trailing comma")
+	}
+	return nil
+}
+
+func (p *sfParser) parseMember() (Member, error) {
+	if p.peek() == '(' {
+		return p.parseInnerList()
+	}
+	return p.parseItem()
+}
+
+func (p *sfParser) parseInnerList() (InnerList, error) {
+	p.i++
+	var items []Item
+	for {
+		p.skipSP()
+		if p.eof() {
+			return InnerList{}, p.fail("unterminated inner list")
+		}
+		if p.peek() == ')' {
+			p.i++
+			params, err := p.parseParams()
+			if err != nil {
+				return InnerList{}, err
+			}
+			return InnerList{Items: items, Params: params}, nil
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return InnerList{}, err
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return InnerList{}, p.fail("expected ' ' or ')' in inner list")
+		}
+	}
+}
+
+func (p *sfParser) parseItem() (Item, error) {
+	value, err := p.parseBareItem()
+	if err != nil {
+		return Item{}, err
+	}
+	params, err := p.parseParams()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{Value: value, Params: params}, nil
+}
+
+func (p *sfParser) parseParams() (Params, error) {
+	var params Params
+	for p.peek() == ';' {
+		p.i++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var value any = true
+		if p.peek() == '=' {
+			p.i++
+			if value, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params = setParam(params, key, value)
+	}
+	return params, nil
+}
+
+func setParam(params Params, key string, value any) Params {
+	for i := range params {
+		if params[i].Key == key {
+			params[i].Value = value
+			return params
+		}
+	}
+	return append(params, Param{Key: key, Value: value})
+}
+
+func (p *sfParser) parseKey() (string, error) {
+	start := p.i
+	if c := p.peek(); !isLowerAlpha(c) && c != '*' {
+		return "", p.fail("invalid key")
+	}
+	for !p.eof() && isKeyChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) parseBareItem() (any, error) {
+	switch c := p.peek(); {
+	case c == '-' || isDigitByte(c):
+		return p.parseNumber()
+	case c == '"':
+		return p.parseString()
+	case c == '*' || isAlphaByte(c):
+		return p.parseToken(), nil
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		return p.parseBoolean()
+	case p.eof():
+		return nil, p.fail("missing item")
+	default:
+		return nil, p.fail("unexpected %q", c)
+	}
+}
+
+func (p *sfParser) parseNumber() (any, error) {
+	start := p.i
+	if p.peek() == '-' {
+		p.i++
+	}
+	if !isDigitByte(p.peek()) {
+		return nil, p.fail("number has no digits")
+	}
+	digits := p.i
+	decimal := false
+	for !p.eof() {
+		c := p.s[p.i]
+		if isDigitByte(c) {
+			p.i++
+		} else if c == '.' && !decimal {
+			if p.i-digits > 12 {
+				return nil, p.fail("decimal has too many integer digits")
+			}
+			decimal = true
+			p.i++
+		} else {
+			break
+		}
+		if !decimal && p.i-digits > 15 {
+			return nil, p.fail("integer has too many digits")
+		}
+		if decimal && p.i-digits > 16 {
+			return nil, p.fail("decimal has too many digits")
+		}
+	}
+	number := p.s[start:p.i]
+	if !decimal {
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil {
+			return nil, p.fail("invalid integer")
+		}
+		return n, nil
+	}
+	_, fraction, _ := strings.Cut(number, ".")
+	if len(fraction) == 0 || len(fraction) > 3 {
+		return nil, p.fail("decimal must have one to three fractional digits")
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return nil, p.fail("invalid decimal")
+	}
+	return f, nil
+}
+
+func (p *sfParser) parseString() (string, error) {
+	p.i++
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+		switch {
+		case c == '\\':
+			if next := p.peek(); next != '"' && next != '\\' {
+				return "", p.fail("invalid escape in string")
+			}
+			b.WriteByte(p.s[p.i])
+			p.i++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.fail("invalid character %q in string", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.fail("unterminated string")
+}
+
+func (p *sfParser) parseToken() Token {
+	start := p.i
+	p.i++
+	for !p.eof() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return Token(p.s[start:p.i])
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.i++
+	end := strings.IndexByte(p.s[p.i:], ':')
+	if end == -1 {
+		return nil, p.fail("unterminated byte sequence")
+	}
+	content := p.s[p.i : p.i+end]
+	for i := 0; i < len(content); i++ {
+		if c := content[i]; !isAlphaByte(c) && !isDigitByte(c) && c != '+' && c != '/' && c != '=' {
+			return nil, p.fail("invalid character %q in byte sequence", c)
+		}
+	}
+	p.i += end + 1
+	if pad := len(content) % 4; pad != 0 {
+		content += strings.Repeat("=", 4-pad)
+	}
+	b, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, p.fail("invalid base64 in byte sequence")
+	}
+	return b, nil
+}
+
+func (p *sfParser) parseBoolean() (bool, error) {
+	p.i++
+	switch p.peek() {
+	case '1':
+		p.i++
+		return true, nil
+	case '0':
+		p.i++
+		return false, nil
+	}
+	return false, p.fail("invalid boolean")
+}
+
+// SerializeItem serializes item following RFC 8941 §4.1.
+func SerializeItem(item Item) (string, error) {
+	var b strings.Builder
+	if err := writeItem(&b, item); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// SerializeList serializes list. An empty list serializes to "".
+func SerializeList(list List) (string, error) {
+	var b strings.Builder
+	for i, member := range list {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeMember(&b, member); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// SerializeDictionary serializes dict. Members whose value is the Boolean true
+// are written as the key alone. An empty dictionary serializes to "".
+func SerializeDictionary(dict Dictionary) (string, error) {
+	var b strings.Builder
+	for i, m := range dict {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := writeKey(&b, m.Key); err != nil {
+			return "", err
+		}
+		if item, ok := m.Value.(Item); ok && item.Value == true {
+			if err := writeParams(&b, item.Params); err != nil {
+				return "", err
+			}
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeMember(&b, m.Value); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func writeMember(b *strings.Builder, member Member) error {
+	switch m := member.(type) {
+	case Item:
+		return writeItem(b, m)
+	case InnerList:
+		b.WriteByte('(')
+		for i, item := range m.Items {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if err := writeItem(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(')')
+		return writeParams(b, m.Params)
+	default:
+		return fmt.Errorf("unsupported member type %T: %w", member, ErrInvalidStructuredField)
+	}
+}
+
+func writeItem(b *strings.Builder, item Item) error {
+	if err := writeBareItem(b, item.Value); err != nil {
+		return err
+	}
+	return writeParams(b, item.Params)
+}
+
+func writeParams(b *strings.Builder, params Params) error {
+	for _, param := range params {
+		b.WriteByte(';')
+		if err := writeKey(b, param.Key); err != nil {
+			return err
+		}
+		if param.Value == true {
+			continue
+		}
+		b.WriteByte('=')
+		if err := writeBareItem(b, param.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeKey(b *strings.Builder, key string) error {
+	if len(key) == 0 || (!isLowerAlpha(key[0]) && key[0] != '*') {
+		return fmt.Errorf("invalid key '%s': %w", key, ErrInvalidStructuredField)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isKeyChar(key[i]) {
+			return fmt.Errorf("invalid key '%s': %w", key, ErrInvalidStructuredField)
+		}
+	}
+	b.WriteString(key)
+	return nil
+}
+
+const maxInteger = 999_999_999_999_999
+
+func writeBareItem(b *strings.Builder, value any) error {
+	switch v := value.(type) {
+	case int64:
+		if v < -maxInteger || v > maxInteger {
+			return fmt.Errorf("integer %d out of range: %w", v, ErrInvalidStructuredField)
+		}
+		b.WriteString(strconv.FormatInt(v, 10))
+	case int:
+		return writeBareItem(b, int64(v))
+	case float64:
+		rounded := math.RoundToEven(v*1000) / 1000
+		if math.IsNaN(v) || math.Abs(rounded) >= 1e12 {
+			return fmt.Errorf("decimal %v out of range: %w", v, ErrInvalidStructuredField)
+		}
+		s := strconv.FormatFloat(rounded, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		b.WriteString(s)
+	case string:
+		b.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("invalid character %q in string: %w", c, ErrInvalidStructuredField)
+			}
+			if c == '"' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteByte('"')
+	case Token:
+		if len(v) == 0 || (!isAlphaByte(v[0]) && v[0] != '*') {
+			return fmt.Errorf("invalid token '%s': %w", v, ErrInvalidStructuredField)
+		}
+		for i := 1; i < len(v); i++ {
+			if !isTokenChar(v[i]) {
+				return fmt.Errorf("invalid token '%s': %w", v, ErrInvalidStructuredField)
+			}
+		}
+		b.WriteString(string(v))
+	case []byte:
+		b.WriteByte(':')
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteByte(':')
+	case bool:
+		if v {
+			b.WriteString("?1")
+		} else {
+			b.WriteString("?0")
+		}
+	default:
+		return fmt.Errorf("unsupported bare item type %T: %w", value, ErrInvalidStructuredField)
+	}
+	return nil
+}
+
+func isLowerAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
+
+func isAlphaByte(c byte) bool {
+	return isLowerAlpha(c) || ('A' <= c && c <= 'Z')
+}
+
+func isDigitByte(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isKeyChar(c byte) bool {
+	return isLowerAlpha(c) || isDigitByte(c) || c == '_' || c == '-' || c == '.' || c == '*'
+}
+
+// isTokenChar reports whether c may follow the first character of a token.
+func isTokenChar(c byte) bool {
+	return tokenChars[c] || c == ':' || c == '/'
+}
@@ -0,0 +1,236 @@
+package headers
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sfTest is a test case in the format of the HTTP WG structured field tests,
+// see testdata/structured-fields/README.md.
+type sfTest struct {
+	Name       string   `json:"name"`
+	Raw        []string `json:"raw"`
+	HeaderType string   `json:"header_type"`
+	Expected   any      `json:"expected"`
+	MustFail   bool     `json:"must_fail"`
+	CanFail    bool     `json:"can_fail"`
+	Canonical  []string `json:"canonical"`
+}
+
+func loadSFTests(t *testing.T, pattern string) map[string][]sfTest {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	suites := make(map[string][]sfTest)
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		dec := json.NewDecoder(f)
+		dec.UseNumber()
+		var tests []sfTest
+		require.NoError(t, dec.Decode(&tests), file)
+		f.Close()
+		suites[filepath.Base(file)] = tests
+	}
+	return suites
+}
+
+// parseSF reads the field from h the way its header type says.
+func parseSF(h Headers, headerType string) (any, error) {
+	switch headerType {
+	case "item":
+		return h.ItemField("Example")
+	case "list":
+		return h.ListField("Example")
+	default:
+		return h.DictionaryField("Example")
+	}
+}
+
+func serializeSF(v any) (string, error) {
+	switch v := v.(type) {
+	case Item:
+		return SerializeItem(v)
+	case List:
+		return SerializeList(v)
+	default:
+		return SerializeDictionary(v.(Dictionary))
+	}
+}
+
+// sfFromJSON converts the JSON form of an expected value into the types
+// returned by the parser.
+func sfFromJSON(t *testing.T, headerType string, v any) any {
+	switch headerType {
+	case "item":
+		return sfItem(t, v)
+	case "list":
+		var list List
+		for _, member := range v.([]any) {
+			list = append(list, sfMember(t, member))
+		}
+		return list
+	default:
+		var dict Dictionary
+		for _, m := range v.([]any) {
+			pair := m.([]any)
+			dict = append(dict, DictMember{Key: pair[0].(string), Value: sfMember(t, pair[1])})
+		}
+		return dict
+	}
+}
+
+func sfMember(t *testing.T, v any) Member {
+	pair := v.([]any)
+	inner, ok := pair[0].([]any)
+	if !ok {
+		return sfItem(t, v)
+	}
+	var items []Item
+	for _, item := range inner {
+		items = append(items, sfItem(t, item))
+	}
+	return InnerList{Items: items, Params: sfParams(t, pair[1])}
+}
+
+func sfItem(t *testing.T, v any) Item {
+	pair := v.([]any)
+	return Item{Value: sfBareItem(t, pair[0]), Params: sfParams(t, pair[1])}
+}
+
+func sfParams(t *testing.T, v any) Params {
+	var params Params
+	for _, p := range v.([]any) {
+		pair := p.([]any)
+		params = append(params, Param{Key: pair[0].(string), Value: sfBareItem(t, pair[1])})
+	}
+	return params
+}
+
+func sfBareItem(t *testing.T, v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			f, err := v.Float64()
+			require.NoError(t, err)
+			return f
+		}
+		n, err := v.Int64()
+		require.NoError(t, err)
+		return n
+	case map[string]any:
+		value := v["value"].(string)
+		switch v["__type"] {
+		case "token":
+			return Token(value)
+		case "binary":
+			b, err := base32.StdEncoding.DecodeString(value)
+			require.NoError(t, err)
+			return b
+		}
+		t.Fatalf("unsupported type %v", v["__type"])
+	}
+	return v
+}
+
+func TestStructuredFieldParse(t *testing.T) {
+	for file, tests := range loadSFTests(t, filepath.Join("testdata", "structured-fields", "*.json")) {
+		for _, tc := range tests {
+			name := file + ": " + tc.Name
+			h := NewHeaders()
+			for _, raw := range tc.Raw {
+				h.Add("Example", raw)
+			}
+			got, err := parseSF(h, tc.HeaderType)
+			if tc.MustFail {
+				assert.ErrorIs(t, err, ErrInvalidStructuredField, name)
+				continue
+			}
+			if tc.CanFail && err != nil {
+				continue
+			}
+			if !assert.NoError(t, err, name) {
+				continue
+			}
+			assert.Equal(t, sfFromJSON(t, tc.HeaderType, tc.Expected), got, name)
+
+			canonical := tc.Canonical
+			if canonical == nil {
+				canonical = tc.Raw
+			}
+			serialized, err := serializeSF(got)
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, strings.Join(canonical, ", "), serialized, name)
+			}
+		}
+	}
+}
+
+func TestStructuredFieldSerialize(t *testing.T) {
+	for file, tests := range loadSFTests(t, filepath.Join("testdata", "structured-fields", "serialisation", "*.json")) {
+		for _, tc := range tests {
+			name := file + ": " + tc.Name
+			serialized, err := serializeSF(sfFromJSON(t, tc.HeaderType, tc.Expected))
+			if tc.MustFail {
+				assert.ErrorIs(t, err, ErrInvalidStructuredField, name)
+				continue
+			}
+			if assert.NoError(t, err, name) {
+				assert.Equal(t, strings.Join(tc.Canonical, ", "), serialized, name)
+			}
+		}
+	}
+}
+
+func TestStructuredFieldHeaders(t *testing.T) {
+	// Test: Set and read back a dictionary field
+	h := NewHeaders()
+	require.NoError(t, h.SetDictionaryField("Priority", Dictionary{
+		{Key: "u", Value: Item{Value: int64(3)}},
+		{Key: "i", Value: Item{Value: true}},
+	}))
+	value, _ := h.Get("Priority")
+	assert.Equal(t, "u=3, i", value)
+	dict, err := h.DictionaryField("priority")
+	require.NoError(t, err)
+	urgency, ok := dict.Get("u")
+	require.True(t, ok)
+	assert.Equal(t, int64(3), urgency.(Item).Value)
+
+	// Test: Item parameters
+	require.NoError(t, h.SetItemField("Example", Item{Value: Token("hit"), Params: Params{{Key: "ttl", Value: 30}}}))
+	item, err := h.ItemField("Example")
+	require.NoError(t, err)
+	ttl, ok := item.Params.Get("ttl")
+	require.True(t, ok)
+	assert.Equal(t, int64(30), ttl)
+
+	// Test: An empty list removes the field, a missing field is reported
+	require.NoError(t, h.SetListField("Example", nil))
+	_, err = h.ListField("Example")
+	assert.ErrorIs(t, err, ErrMissingField)
+
+	// Test: Parsed fields keep the whitespace around ':' in byte sequences
+	h = NewHeaders()
+	_, _, err = h.Parse([]byte("X-B: (:AQ==: :Ag==:), \"a : b\"\r\n"))
+	require.NoError(t, err)
+	list, err := h.ListField("X-B")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, InnerList{Items: []Item{{Value: []byte{1}}, {Value: []byte{2}}}}, list[0])
+	assert.Equal(t, Item{Value: "a : b"}, list[1])
+
+	// Test: Values that cannot be serialized leave the field untouched
+	h.Set("Example", "1")
+	assert.ErrorIs(t, h.SetItemField("Example", Item{Value: "bad\n"}), ErrInvalidStructuredField)
+	value, _ = h.Get("Example")
+	assert.Equal(t, "1", value)
+}
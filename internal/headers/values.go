@@ -0,0 +1,247 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingField is returned by the typed accessors when the field is not
+// present at all.
+var ErrMissingField = errors.New("field not present")
+
+// ContentLength returns the value of the Content-Length field. It must be made
+// of digits only; repeated values, as separate lines or a comma-separated
+// list, are accepted only when they are all identical.
+func (h Headers) ContentLength() (int64, error) {
+	lines := h.Values("Content-Length")
+	if len(lines) == 0 {
+		return 0, fmt.Errorf("content length: %w", ErrMissingField)
+	}
+	contentLength := int64(-1)
+	for _, line := range lines {
+		for _, v := range strings.Split(line, ",") {
+			v = strings.Trim(v, " \t")
+			if len(v) == 0 {
+				return 0, fmt.Errorf("empty content length in '%s': %w", line, ErrInvalidFieldValue)
+			}
+			for i := 0; i < len(v); i++ {
+				if v[i] < '0' || v[i] > '9' {
+					return 0, fmt.Errorf("content length '%s' is not a number: %w", v, ErrInvalidFieldValue)
+				}
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("content length '%s' out of range: %w", v, ErrInvalidFieldValue)
+			}
+			if contentLength != -1 && n != contentLength {
+				return 0, fmt.Errorf("conflicting content lengths in '%s': %w", line, ErrInvalidFieldValue)
+			}
+			contentLength = n
+		}
+	}
+	return contentLength, nil
+}
+
+// ContentType parses the Content-Type field with ParseMediaType.
+func (h Headers) ContentType() (string, map[string]string, error) {
+	value, exists := h.Get("Content-Type")
+	if !exists {
+		return "", nil, fmt.Errorf("content type: %w", ErrMissingField)
+	}
+	return ParseMediaType(value)
+}
+
+// ParseMediaType parses a media type such as `text/html; charset="utf-8"`
+// (RFC 9110 §8.3.1). The type and parameter names are lowercased, since they
+// are case-insensitive, and quoted parameter values are unquoted. The returned
+// map is nil when there are no parameters.
+func ParseMediaType(value string) (string, map[string]string, error) {
+	rest := strings.TrimLeft(value, " \t")
+	typ, rest := cutToken(rest)
+	if len(typ) == 0 || len(rest) == 0 || rest[0] != '/' {
+		return "", nil, fmt.Errorf("invalid media type '%s': %w", value, ErrInvalidFieldValue)
+	}
+	subtype, rest := cutToken(rest[1:])
+	if len(subtype) == 0 {
+		return "", nil, fmt.Errorf("invalid media type '%s': %w", value, ErrInvalidFieldValue)
+	}
+	mediaType := strings.ToLower(typ + "/" + subtype)
+
+	var params map[string]string
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if len(rest) == 0 {
+			return mediaType, params, nil
+		}
+		if rest[0] != ';' {
+			return "", nil, fmt.Errorf("unexpected %q in media type '%s': %w", rest[0], value, ErrInvalidFieldValue)
+		}
+		rest = strings.TrimLeft(rest[1:], " \t")
+		if len(rest) == 0 {
+			return mediaType, params, nil
+		}
+
+		var name, paramValue string
+		name, rest = cutToken(rest)
+		if len(name) == 0 || len(rest) == 0 || rest[0] != '=' {
+			return "", nil, fmt.Errorf("invalid parameter in media type '%s': %w", value, ErrInvalidFieldValue)
+		}
+		rest = rest[1:]
+		if len(rest) > 0 && rest[0] == '"' {
+			var err error
+			paramValue, rest, err = cutQuotedString(rest)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid parameter in media type '%s': %w", value, err)
+			}
+		} else {
+			paramValue, rest = cutToken(rest)
+			if len(paramValue) == 0 {
+				return "", nil, fmt.Errorf("empty parameter value in media type '%s': %w", value, ErrInvalidFieldValue)
+			}
+		}
+
+		name = strings.ToLower(name)
+		if params == nil {
+			params = make(map[string]string)
+		}
+		if _, exists := params[name]; exists {
+			return "", nil, fmt.Errorf("duplicate parameter '%s' in media type '%s': %w", name, value, ErrInvalidFieldValue)
+		}
+		params[name] = paramValue
+	}
+}
+
+// cutToken splits s after its leading run of token characters.
+func cutToken(s string) (string, string) {
+	i := 0
+	for i < len(s) && tokenChars[s[i]] {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// cutQuotedString reads the quoted-string at the start of s, resolving
+// backslash escapes, and returns its content and whatever follows it.
+func cutQuotedString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", fmt.Errorf("unterminated quoted-string: %w", ErrInvalidFieldValue)
+			}
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated quoted-string: %w", ErrInvalidFieldValue)
+}
+
+// List returns the elements of a comma-separated list field such as
+// Connection, Accept-Encoding or Trailer (RFC 9110 §5.6.1), across every field
+// line named key. Whitespace around elements is removed, empty elements are
+// skipped, and commas inside quoted strings do not split an element.
+func (h Headers) List(key string) []string {
+	var elements []string
+	for _, value := range h.Values(key) {
+		start := 0
+		quoted := false
+		for i := 0; i < len(value); i++ {
+			switch value[i] {
+			case '"':
+				quoted = !quoted
+			case '\\':
+				if quoted {
+					i++
+				}
+			case ',':
+				if !quoted {
+					elements = appendElement(elements, value[start:i])
+					start = i + 1
+				}
+			}
+		}
+		elements = appendElement(elements, value[start:])
+	}
+	return elements
+}
+
+func appendElement(elements []string, element string) []string {
+	element = strings.Trim(element, " \t")
+	if len(element) == 0 {
+		return elements
+	}
+	return append(elements, element)
+}
+
+// HasToken reports whether the list field named key contains token, compared
+// without regard to case. Parameters after a ';' are ignored.
+func (h Headers) HasToken(key, token string) bool {
+	for _, element := range h.List(key) {
+		name, _, _ := strings.Cut(element, ";")
+		if strings.EqualFold(strings.TrimRight(name, " \t"), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeFormat is the preferred HTTP-date format, IMF-fixdate (RFC 9110 §5.6.7).
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// timeFormats are the formats a recipient must accept: IMF-fixdate and the
+// obsolete RFC 850 and asctime formats.
+var timeFormats = []string{
+	TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// ParseTime parses an HTTP-date in any of the three formats. A two-digit RFC
+// 850 year that would put the date more than 50 years in the future is read
+// as being in the past century.
+func ParseTime(value string) (time.Time, error) {
+	for i, layout := range timeFormats {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if i == 1 {
+			now := time.Now().UTC()
+			if t.After(now.AddDate(50, 0, 0)) {
+				t = t.AddDate(-100, 0, 0)
+			} else if !t.After(now.AddDate(-50, 0, 0)) {
+				t = t.AddDate(100, 0, 0)
+			}
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid HTTP-date '%s': %w", value, ErrInvalidFieldValue)
+}
+
+// FormatTime formats t as an IMF-fixdate.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(TimeFormat)
+}
+
+// Time parses the HTTP-date in the field named key, such as Date,
+// Last-Modified or If-Modified-Since.
+func (h Headers) Time(key string) (time.Time, error) {
+	value, exists := h.Get(key)
+	if !exists {
+		return time.Time{}, fmt.Errorf("%s: %w", key, ErrMissingField)
+	}
+	return ParseTime(value)
+}
+
+// SetTime sets the field named key to t formatted as an IMF-fixdate.
+func (h *Headers) SetTime(key string, t time.Time) {
+	h.Set(key, FormatTime(t))
+}
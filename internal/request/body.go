@@ -0,0 +1,183 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// bufferPool holds read buffers of bufferSize bytes. A source only holds on
+// to a buffer while a request is in flight, so idle connections cost nothing.
+var bufferPool = sync.Pool{
+	New: func() any {
+		buff := make([]byte, bufferSize)
+		return &buff
+	},
+}
+
+// source buffers bytes read from the underlying reader that have not been
+// consumed by the parser yet.
+type source struct {
+	reader      io.Reader
+	buff        []byte
+	readToIndex int
+	// first receives the byte read by wait, so no buffer is held while the
+	// connection is idle.
+	first [1]byte
+}
+
+func (s *source) acquire() {
+	if s.buff == nil {
+		s.buff = *bufferPool.Get().(*[]byte)
+	}
+}
+
+// release returns the buffer to the pool once it holds no unparsed bytes.
+// Buffers that had to grow are left to the garbage collector.
+func (s *source) release() {
+	if s.buff == nil || s.readToIndex != 0 {
+		return
+	}
+	if buff := s.buff; len(buff) == bufferSize {
+		bufferPool.Put(&buff)
+	}
+	s.buff = nil
+}
+
+// parseBuffered feeds the bytes left over from earlier reads to the parser
+// and reports how many of them were consumed.
+func (s *source) parseBuffered(req *Request) (int, error) {
+	if s.readToIndex == 0 {
+		return 0, nil
+	}
+	bytesConsumed, err := req.parse(s.buff[:s.readToIndex])
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse request: %w", err)
+	}
+	copy(s.buff, s.buff[bytesConsumed:s.readToIndex])
+	s.readToIndex -= bytesConsumed
+	if req.ParserState == requestStateDone {
+		s.release()
+	}
+	return bytesConsumed, nil
+}
+
+// advance moves the parser forward, using buffered bytes when they are enough
+// and reading from the underlying reader otherwise.
+func (s *source) advance(req *Request) error {
+	n, err := s.parseBuffered(req)
+	if err != nil {
+		return err
+	}
+	if n > 0 || req.ParserState == requestStateDone {
+		return nil
+	}
+	return s.readAndParse(req)
+}
+
+// wait blocks until at least one unparsed byte is buffered.
+func (s *source) wait() error {
+	for s.readToIndex == 0 {
+		n, err := s.reader.Read(s.first[:])
+		if n > 0 {
+			s.acquire()
+			s.buff[0] = s.first[0]
+			s.readToIndex = n
+			return nil
+		}
+		if err == io.EOF {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to wait for request: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *source) readAndParse(req *Request) error {
+	s.acquire()
+	if s.readToIndex >= len(s.buff) {
+		newBuff := make([]byte, len(s.buff)*2)
+		copy(newBuff, s.buff)
+		if buff := s.buff; len(buff) == bufferSize {
+			bufferPool.Put(&buff)
+		}
+		s.buff = newBuff
+	}
+	n, err := s.reader.Read(s.buff[s.readToIndex:])
+	s.readToIndex += n
+	if n > 0 {
+		if _, err := s.parseBuffered(req); err != nil {
+			return err
+		}
+	}
+	if err == io.EOF {
+		if req.ParserState == requestStateInitialized && s.readToIndex == 0 {
+			return io.EOF
+		}
+		if req.ParserState != requestStateDone {
+			return fmt.Errorf("incomplete request, in state: %d: %w: %w", req.ParserState, ErrIncompleteRequest, io.ErrUnexpectedEOF)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read from index: %w", err)
+	}
+	return nil
+}
+
+// body streams the decoded request body, pulling more bytes from the source
+// only when everything decoded so far has been handed out.
+type body struct {
+	req    *Request
+	src    *source
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+	for len(b.req.decoded) == 0 {
+		if b.req.bodyErr != nil {
+			return 0, b.req.bodyErr
+		}
+		if b.req.ParserState == requestStateDone {
+			return 0, io.EOF
+		}
+		if err := b.src.advance(b.req); err != nil {
+			b.req.bodyErr = err
+			return 0, err
+		}
+	}
+	n := copy(p, b.req.decoded)
+	if n == len(b.req.decoded) {
+		b.req.decoded = b.req.decoded[:0]
+	} else {
+		b.req.decoded = b.req.decoded[n:]
+	}
+	return n, nil
+}
+
+// drain discards whatever is left of the body so the source is positioned at
+// the start of the next request.
+func (b *body) drain() error {
+	b.req.decoded = b.req.decoded[:0]
+	for b.req.ParserState != requestStateDone {
+		if b.req.bodyErr != nil {
+			return b.req.bodyErr
+		}
+		if err := b.src.advance(b.req); err != nil {
+			b.req.bodyErr = err
+			return err
+		}
+		b.req.decoded = b.req.decoded[:0]
+	}
+	return nil
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
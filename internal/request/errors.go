@@ -0,0 +1,23 @@
+package request
+
+import "errors"
+
+// Errors returned while reading a request. They are wrapped with details
+// about the offending input, so compare them with errors.Is.
+var (
+	ErrMalformedRequestLine      = errors.New("malformed request line")
+	ErrInvalidMethod             = errors.New("invalid method")
+	ErrInvalidTarget             = errors.New("invalid request target")
+	ErrUnsupportedVersion        = errors.New("unsupported http version")
+	ErrInvalidContentLength      = errors.New("invalid content length")
+	ErrConflictingFraming        = errors.New("conflicting message framing")
+	ErrInvalidTransferEncoding   = errors.New("invalid transfer encoding")
+	ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+	ErrMalformedChunk            = errors.New("malformed chunked encoding")
+	ErrInvalidTrailer            = errors.New("invalid trailer")
+	ErrIncompleteRequest         = errors.New("incomplete request")
+	ErrRequestLineTooLong        = errors.New("request line too long")
+	ErrHeaderFieldsTooLarge      = errors.New("request header fields too large")
+	ErrBodyTooLarge              = errors.New("request body too large")
+	ErrBodyClosed                = errors.New("read on closed body")
+)
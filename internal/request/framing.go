@@ -0,0 +1,79 @@
+package request
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// startBody decides how the message body is delimited once the headers are
+// complete, following RFC 9112 §6.3. Anything that could be read differently
+// by another server on the path is rejected rather than guessed at.
+func (r *Request) startBody() error {
+	te, hasTE := r.Headers.Get("Transfer-Encoding")
+	_, hasCL := r.Headers.Get("Content-Length")
+
+	if hasTE {
+		if hasCL {
+			return fmt.Errorf("request has both Content-Length and Transfer-Encoding: %w", ErrConflictingFraming)
+		}
+		if r.RequestLine.VersionMinor == 0 {
+			return fmt.Errorf("transfer encoding in an HTTP/1.0 request: %w", ErrInvalidTransferEncoding)
+		}
+		if err := checkTransferEncoding(te); err != nil {
+			return err
+		}
+		r.ParserState = requestStateParsingChunkSize
+		return nil
+	}
+
+	if !hasCL {
+		r.ParserState = requestStateDone
+		return nil
+	}
+	n, err := r.Headers.ContentLength()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidContentLength, err)
+	}
+	if n > math.MaxInt {
+		return fmt.Errorf("content length %d out of range: %w", n, ErrInvalidContentLength)
+	}
+	contentLength := int(n)
+	if err := r.checkBodySize(contentLength); err != nil {
+		return err
+	}
+	if contentLength == 0 {
+		r.ParserState = requestStateDone
+		return nil
+	}
+	r.contentRemaining = contentLength
+	r.ParserState = requestStateParsingBody
+	return nil
+}
+
+// checkTransferEncoding requires chunked to be the final transfer coding, as
+// the body length cannot be determined otherwise, and rejects any other
+// coding since chunked is the only one the parser can decode.
+func checkTransferEncoding(value string) error {
+	codings := make([]string, 0, 1)
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.Trim(coding, " \t")
+		if len(coding) == 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(coding, ";")
+		codings = append(codings, strings.ToLower(strings.Trim(name, " \t")))
+	}
+	if len(codings) == 0 || codings[len(codings)-1] != "chunked" {
+		return fmt.Errorf("chunked is not the final transfer coding in '%s': %w", value, ErrInvalidTransferEncoding)
+	}
+	for _, coding := range codings[:len(codings)-1] {
+		if coding == "chunked" {
+			return fmt.Errorf("chunked applied more than once in '%s': %w", value, ErrInvalidTransferEncoding)
+		}
+	}
+	if len(codings) > 1 {
+		return fmt.Errorf("transfer coding '%s': %w", codings[0], ErrUnsupportedTransferCoding)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package request
+
+import "fmt"
+
+// maxChunkLineLength bounds a chunk-size line including its extensions.
+const maxChunkLineLength = 4096
+
+// Limits bounds how much of a request the parser accepts. A zero field means
+// no limit.
+type Limits struct {
+	MaxRequestLineLength int
+	MaxHeaderBytes       int
+	MaxHeaderCount       int
+	MaxBodySize          int
+}
+
+var DefaultLimits = Limits{
+	MaxRequestLineLength: 8 << 10,
+	MaxHeaderBytes:       1 << 20,
+	MaxHeaderCount:       100,
+	MaxBodySize:          10 << 20,
+}
+
+func (r *Request) checkRequestLine(lineLength int) error {
+	max := r.limits.MaxRequestLineLength
+	if max > 0 && lineLength > max {
+		return fmt.Errorf("request line exceeds %d bytes: %w", max, ErrRequestLineTooLong)
+	}
+	return nil
+}
+
+// checkHeaderLimits accounts for a header or trailer field line of n bytes.
+// When n is 0 the parser is waiting for the rest of a line, and pending is the
+// number of bytes of that line buffered so far.
+func (r *Request) checkHeaderLimits(n int, done bool, pending int) error {
+	maxBytes := r.limits.MaxHeaderBytes
+	if n == 0 {
+		if maxBytes > 0 && r.headerBytes+pending > maxBytes {
+			return fmt.Errorf("header fields exceed %d bytes: %w", maxBytes, ErrHeaderFieldsTooLarge)
+		}
+		return nil
+	}
+	r.headerBytes += n
+	if maxBytes > 0 && r.headerBytes > maxBytes {
+		return fmt.Errorf("header fields exceed %d bytes: %w", maxBytes, ErrHeaderFieldsTooLarge)
+	}
+	if !done {
+		r.headerCount++
+		maxCount := r.limits.MaxHeaderCount
+		if maxCount > 0 && r.headerCount > maxCount {
+			return fmt.Errorf("more than %d header fields: %w", maxCount, ErrHeaderFieldsTooLarge)
+		}
+	}
+	return nil
+}
+
+func (r *Request) checkBodySize(size int) error {
+	max := r.limits.MaxBodySize
+	if max > 0 && size > max {
+		return fmt.Errorf("body exceeds %d bytes: %w", max, ErrBodyTooLarge)
+	}
+	return nil
+}
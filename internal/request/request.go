@@ -1,6 +1,7 @@
 package request
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -11,39 +12,63 @@ import (
 	"github.com/CodeZeroSugar/internal/headers"
 )
 
-const bufferSize = 8
+const bufferSize = 4096
+
+var crlf = []byte("\r\n")
 
 type Request struct {
 	RequestLine RequestLine
+	Target      Target
 	Headers     headers.Headers
-	Body        []byte
+	Body        io.ReadCloser
+	Trailers    headers.Headers
 	ParserState ParserState
+
+	limits           Limits
+	headerBytes      int
+	headerCount      int
+	bodySize         int
+	contentRemaining int
+	chunkRemaining   int
+	decoded          []byte
+	bodyBytes        []byte
+	bodyErr          error
+	pathValues       map[string]string
 }
 
 type ParserState int
 
 const (
-	requestStateInitialized    = 0
-	requestStateDone           = 1
-	requestStateParsingHeaders = 2
-	requestStateParsingBody    = 3
+	requestStateInitialized          = 0
+	requestStateDone                 = 1
+	requestStateParsingHeaders       = 2
+	requestStateParsingBody          = 3
+	requestStateParsingChunkSize     = 4
+	requestStateParsingChunkData     = 5
+	requestStateParsingChunkDataCRLF = 6
+	requestStateParsingTrailers      = 7
 )
 
 type RequestLine struct {
 	HttpVersion   string
+	VersionMajor  int
+	VersionMinor  int
 	RequestTarget string
 	Method        string
 }
 
+// parse consumes as much of data as it can. It stops at the end of the header
+// section, so the body is only decoded once it is read through Body.
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
 	for r.ParserState != requestStateDone {
+		inHeaders := !r.headersDone()
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
 		}
 		totalBytesParsed += n
-		if n == 0 {
+		if n == 0 || (inHeaders && r.headersDone()) {
 			break
 		}
 	}
@@ -54,16 +79,32 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	bytesParsed := 0
 	switch r.ParserState {
 	case requestStateInitialized:
+		// Empty lines before the request line, such as a CRLF a client sent
+		// after the previous request body, are ignored (RFC 9112, section 2.2).
+		if bytes.HasPrefix(data, crlf) {
+			return len(crlf), nil
+		}
 		line, n, err := parseRequestLine(data)
 		if err != nil {
 			return 0, fmt.Errorf("failed to parse request line: %w", err)
 		}
 		if n == 0 {
+			if err := r.checkRequestLine(len(data)); err != nil {
+				return 0, err
+			}
 			return 0, nil
 		}
+		if err := r.checkRequestLine(n - 2); err != nil {
+			return 0, err
+		}
+		target, err := parseTarget(line.Method, line.RequestTarget)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse request target: %w: %w", ErrInvalidTarget, err)
+		}
 
 		bytesParsed += n
 		r.RequestLine = line
+		r.Target = target
 		r.ParserState = requestStateParsingHeaders
 
 		return bytesParsed, nil
@@ -73,31 +114,89 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		if err := r.checkHeaderLimits(n, done, len(data)); err != nil {
+			return 0, err
+		}
 		bytesParsed += n
 		if done {
-			r.ParserState = requestStateParsingBody
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
 		}
 		return bytesParsed, nil
 
 	case requestStateParsingBody:
-		value, exists := r.Headers.Get("Content-Length")
-		if !exists {
+		n := min(len(data), r.contentRemaining)
+		r.decoded = append(r.decoded, data[:n]...)
+		r.contentRemaining -= n
+		if r.contentRemaining == 0 {
 			r.ParserState = requestStateDone
+		}
+		bytesParsed += n
+
+		return bytesParsed, nil
+
+	case requestStateParsingChunkSize:
+		idx := bytes.Index(data, crlf)
+		if idx == -1 {
+			if len(data) > maxChunkLineLength {
+				return 0, fmt.Errorf("chunk size line exceeds %d bytes: %w", maxChunkLineLength, ErrMalformedChunk)
+			}
 			return 0, nil
 		}
-		contentLength, err := strconv.Atoi(value)
+		size, err := parseChunkSize(data[:idx])
 		if err != nil {
-			return 0, fmt.Errorf("content length failed to convert to int: %w", err)
+			return 0, err
 		}
-		r.Body = append(r.Body, data...)
-		if len(r.Body) > contentLength {
-			return 0, fmt.Errorf("length of data was greater than Content-Length %d:%d", len(r.Body), contentLength)
+		r.bodySize += size
+		if err := r.checkBodySize(r.bodySize); err != nil {
+			return 0, err
 		}
-		if len(r.Body) == contentLength {
-			r.ParserState = requestStateDone
+		bytesParsed += idx + 2
+		if size == 0 {
+			r.ParserState = requestStateParsingTrailers
+		} else {
+			r.chunkRemaining = size
+			r.ParserState = requestStateParsingChunkData
 		}
-		bytesParsed += len(data)
+		return bytesParsed, nil
 
+	case requestStateParsingChunkData:
+		n := min(len(data), r.chunkRemaining)
+		r.decoded = append(r.decoded, data[:n]...)
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.ParserState = requestStateParsingChunkDataCRLF
+		}
+		bytesParsed += n
+		return bytesParsed, nil
+
+	case requestStateParsingChunkDataCRLF:
+		if len(data) < 2 {
+			return 0, nil
+		}
+		if !bytes.HasPrefix(data, crlf) {
+			return 0, fmt.Errorf("chunk data was not followed by CRLF: %w", ErrMalformedChunk)
+		}
+		bytesParsed += 2
+		r.ParserState = requestStateParsingChunkSize
+		return bytesParsed, nil
+
+	case requestStateParsingTrailers:
+		n, done, err := r.Trailers.Parse(data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse trailers: %w: %w", ErrInvalidTrailer, err)
+		}
+		if err := r.checkHeaderLimits(n, done, len(data)); err != nil {
+			return 0, err
+		}
+		bytesParsed += n
+		if done {
+			if err := r.validateTrailers(); err != nil {
+				return 0, err
+			}
+			r.ParserState = requestStateDone
+		}
 		return bytesParsed, nil
 
 	case requestStateDone:
@@ -108,83 +207,265 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	}
 }
 
-func parseRequestLine(buff []byte) (RequestLine, int, error) {
-	str := string(buff)
+func (r *Request) headersDone() bool {
+	return r.ParserState != requestStateInitialized && r.ParserState != requestStateParsingHeaders
+}
 
-	hasNewLine := strings.Contains(str, "\r\n")
-	if !hasNewLine {
-		return RequestLine{}, 0, nil
+// forbiddenTrailers are fields that control framing or routing and must never
+// be taken from the trailer section.
+var forbiddenTrailers = map[string]bool{
+	"content-length":    true,
+	"transfer-encoding": true,
+	"host":              true,
+	"trailer":           true,
+	"connection":        true,
+}
+
+func (r *Request) validateTrailers() error {
+	if r.Trailers.Len() == 0 {
+		return nil
+	}
+	announced := make(map[string]bool)
+	for _, name := range r.Headers.List("Trailer") {
+		announced[strings.ToLower(name)] = true
+	}
+	for name := range r.Trailers.All() {
+		key := strings.ToLower(name)
+		if forbiddenTrailers[key] {
+			return fmt.Errorf("field '%s' is not allowed in trailers: %w", name, ErrInvalidTrailer)
+		}
+		if !announced[key] {
+			return fmt.Errorf("trailer '%s' was not announced in the Trailer header: %w", name, ErrInvalidTrailer)
+		}
 	}
-	parts := strings.SplitAfter(str, "\r\n")
-	firstLineWithCRLF := parts[0]
-	n := len(firstLineWithCRLF)
+	return nil
+}
 
-	linesText := firstLineWithCRLF[:n-2]
+func parseChunkSize(line []byte) (int, error) {
+	if idx := bytes.IndexByte(line, ';'); idx != -1 {
+		for _, c := range line[idx+1:] {
+			if (c < ' ' && c != '\t') || c == 0x7f {
+				return 0, fmt.Errorf("invalid character %q in chunk extension: %w", c, ErrMalformedChunk)
+			}
+		}
+		line = line[:idx]
+	}
+	sizeStr := strings.TrimRight(string(line), " \t")
+	if len(sizeStr) == 0 {
+		return 0, fmt.Errorf("chunk size is empty: %w", ErrMalformedChunk)
+	}
+	for _, c := range sizeStr {
+		if !unicode.Is(unicode.ASCII_Hex_Digit, c) {
+			return 0, fmt.Errorf("invalid character in chunk size '%s': %w", sizeStr, ErrMalformedChunk)
+		}
+	}
+	size, err := strconv.ParseInt(sizeStr, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size '%s': %w: %w", sizeStr, ErrMalformedChunk, err)
+	}
+	return int(size), nil
+}
 
-	fields := strings.Split(linesText, " ")
+// commonMethods interns the standard method names, so parsing them does not
+// allocate.
+var commonMethods = map[string]string{
+	"GET":     "GET",
+	"HEAD":    "HEAD",
+	"POST":    "POST",
+	"PUT":     "PUT",
+	"DELETE":  "DELETE",
+	"CONNECT": "CONNECT",
+	"OPTIONS": "OPTIONS",
+	"TRACE":   "TRACE",
+	"PATCH":   "PATCH",
+}
+
+func parseRequestLine(buff []byte) (RequestLine, int, error) {
+	idx := bytes.Index(buff, crlf)
+	if idx == -1 {
+		return RequestLine{}, 0, nil
+	}
+	n := idx + 2
+	line := buff[:idx]
 
-	if len(fields) != 3 {
-		return RequestLine{}, n, fmt.Errorf("invalid number of parts in request line")
+	sp1 := bytes.IndexByte(line, ' ')
+	if sp1 == -1 {
+		return RequestLine{}, n, fmt.Errorf("invalid number of parts in request line: %w", ErrMalformedRequestLine)
+	}
+	sp2 := bytes.IndexByte(line[sp1+1:], ' ')
+	if sp2 == -1 {
+		return RequestLine{}, n, fmt.Errorf("invalid number of parts in request line: %w", ErrMalformedRequestLine)
+	}
+	sp2 += sp1 + 1
+	if bytes.IndexByte(line[sp2+1:], ' ') != -1 {
+		return RequestLine{}, n, fmt.Errorf("invalid number of parts in request line: %w", ErrMalformedRequestLine)
 	}
 
-	m, t, v := fields[0], fields[1], fields[2]
+	m, t, v := line[:sp1], line[sp1+1:sp2], line[sp2+1:]
+	if len(m) == 0 {
+		return RequestLine{}, n, fmt.Errorf("method is empty: %w", ErrInvalidMethod)
+	}
 
-	for _, r := range m {
-		if !unicode.IsUpper(r) || !unicode.IsLetter(r) {
-			return RequestLine{}, n, fmt.Errorf("found a non-alphabet or lowercase character while parsing request line")
+	for _, c := range m {
+		if c < 'A' || c > 'Z' {
+			return RequestLine{}, n, fmt.Errorf("found a non-alphabet or lowercase character while parsing request line: %w", ErrInvalidMethod)
 		}
 	}
 
-	splitVersion := strings.Split(v, "/")
-	if splitVersion[1] != "1.1" {
-		return RequestLine{}, n, fmt.Errorf("http version was not '1.1'")
+	major, minor, err := parseHTTPVersion(v)
+	if err != nil {
+		return RequestLine{}, n, err
+	}
+
+	method, ok := commonMethods[string(m)]
+	if !ok {
+		method = string(m)
 	}
-	ver := splitVersion[1]
 
 	return RequestLine{
-		HttpVersion:   ver,
-		RequestTarget: t,
-		Method:        m,
+		HttpVersion:   versions[minor],
+		VersionMajor:  major,
+		VersionMinor:  minor,
+		RequestTarget: string(t),
+		Method:        method,
 	}, n, nil
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	buff := make([]byte, bufferSize)
+var versions = [...]string{"1.0", "1.1"}
 
-	var readToIndex int
-	readToIndex = 0
+// parseHTTPVersion parses an HTTP-version of the form "HTTP/" DIGIT "." DIGIT.
+// Well-formed versions other than 1.0 and 1.1 return ErrUnsupportedVersion.
+func parseHTTPVersion(v []byte) (int, int, error) {
+	if len(v) != len("HTTP/1.1") || !bytes.HasPrefix(v, []byte("HTTP/")) || v[6] != '.' || !isDigit(v[5]) || !isDigit(v[7]) {
+		return 0, 0, fmt.Errorf("malformed http version '%s': %w", v, ErrMalformedRequestLine)
+	}
+	major, minor := int(v[5]-'0'), int(v[7]-'0')
+	if major != 1 || minor > 1 {
+		return 0, 0, fmt.Errorf("http version '%s': %w", v, ErrUnsupportedVersion)
+	}
+	return major, minor, nil
+}
+
+// Reader reads successive requests from a single connection. Bytes read past
+// the end of one request are kept and used for the next, which allows clients
+// to pipeline requests.
+type Reader struct {
+	Limits Limits
 
-	req := Request{
+	src  *source
+	prev *body
+}
+
+// NewReader returns a Reader that enforces DefaultLimits.
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		src: &source{
+			reader: reader,
+		},
+	}
+}
+
+// ReadRequest parses the request line and headers of the next request and
+// returns as soon as they are complete. The body is read on demand through
+// Body, which enforces the Content-Length or chunked framing of the request.
+// Any unread body of the previous request is discarded first. io.EOF is
+// returned when the connection is closed cleanly between requests.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if err := rr.discardPrevious(); err != nil {
+		return nil, err
+	}
+
+	req := &Request{
 		ParserState: requestStateInitialized,
 		Headers:     headers.NewHeaders(),
+		Trailers:    headers.NewHeaders(),
+		limits:      rr.Limits,
 	}
-	for req.ParserState != requestStateDone {
-		if readToIndex >= len(buff) {
-			newBuff := make([]byte, len(buff)*2)
-			copy(newBuff, buff)
-			buff = newBuff
-		}
-		n, err := reader.Read(buff[readToIndex:])
-		if err == io.EOF {
-			if req.ParserState != requestStateDone {
-				return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.ParserState, n)
-			}
-			break
-		}
-		if err != nil {
-			return &Request{}, fmt.Errorf("failed to read from index: %w", err)
+	if _, err := rr.src.parseBuffered(req); err != nil {
+		return nil, err
+	}
+	for !req.headersDone() {
+		if err := rr.src.readAndParse(req); err != nil {
+			return nil, err
 		}
-		readToIndex += n
+	}
+	b := &body{
+		req: req,
+		src: rr.src,
+	}
+	req.Body = b
+	rr.prev = b
+	return req, nil
+}
 
-		bytesConsumed, err := req.parse(buff[:readToIndex])
-		if err != nil {
-			return &Request{}, fmt.Errorf("failed to parse request: %w", err)
-		}
+// Wait discards any unread body of the previous request, then blocks until
+// the first byte of the next request has arrived, without parsing it. io.EOF
+// is returned when the connection is closed cleanly first. A server uses it
+// to tell a connection that is idle between requests from a client that is
+// slow to send one.
+func (rr *Reader) Wait() error {
+	if err := rr.discardPrevious(); err != nil {
+		return err
+	}
+	return rr.src.wait()
+}
 
-		copy(buff, buff[bytesConsumed:readToIndex])
+func (rr *Reader) discardPrevious() error {
+	if rr.prev == nil {
+		return nil
+	}
+	if err := rr.prev.drain(); err != nil {
+		return fmt.Errorf("failed to discard previous request body: %w", err)
+	}
+	rr.prev = nil
+	return nil
+}
 
-		readToIndex -= bytesConsumed
+// RequestFromReader reads a single request from reader. See Reader.ReadRequest.
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
+
+// KeepAlive reports whether the client expects the connection to stay open
+// after this request.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
+	}
+	return r.RequestLine.VersionMinor >= 1 || r.Headers.HasToken("Connection", "keep-alive")
+}
+
+// BodyBytes reads the remaining body into memory and returns it. The result is
+// cached, so it is safe to call more than once.
+func (r *Request) BodyBytes() ([]byte, error) {
+	if r.bodyBytes != nil {
+		return r.bodyBytes, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.bodyBytes = data
+	return data, nil
+}
+
+// BodyError returns the error that stopped the body from being read, such as
+// one wrapping ErrBodyTooLarge, or nil if reading it has not failed.
+func (r *Request) BodyError() error {
+	return r.bodyErr
+}
+
+// PathValue returns the value of the named path parameter matched by a
+// router, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
 
+// SetPathValue sets the named path parameter returned by PathValue.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
 	}
-	return &req, nil
+	r.pathValues[name] = value
 }
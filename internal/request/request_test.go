@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/CodeZeroSugar/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,6 +32,12 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// get returns the combined value of key, or "" when it is missing.
+func get(h headers.Headers, key string) string {
+	value, _ := h.Get(key)
+	return value
+}
+
 func TestRequestLineParse(t *testing.T) {
 	// Test: Good GET Request line
 	reader := &chunkReader{
@@ -88,9 +95,9 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", get(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", get(r.Headers, "accept"))
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -116,7 +123,7 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:42069, localhost:42069", r.Headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:42069, localhost:42069", get(r.Headers, "host"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -134,9 +141,9 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", get(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", get(r.Headers, "accept"))
 
 	// Test: Standard Body
 	reader = &chunkReader{
@@ -150,7 +157,9 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "hello world!\n", string(r.Body))
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(body))
 
 	// Test: Empty Body, 0 reported content length
 	reader = &chunkReader{
@@ -163,7 +172,9 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -175,7 +186,9 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
 
 	// Test: Body shorter than reported content length
 	reader = &chunkReader{
@@ -187,6 +200,9 @@ func TestRequestLineParse(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	_, err = r.BodyBytes()
 	require.Error(t, err)
 
 	// Test: No Content-Length but Body Exists
@@ -200,5 +216,634 @@ func TestRequestLineParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "", string(r.Body))
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
+}
+
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"7\r\n world!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(body))
+
+	// Test: Chunked body read one byte at a time with hex sizes and extensions
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a;name=value\r\n0123456789\r\n" +
+			"1A \r\nabcdefghijklmnopqrstuvwxyz\r\n" +
+			"0;last\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789abcdefghijklmnopqrstuvwxyz", string(body))
+
+	// Test: Empty chunked body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "", string(body))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.Error(t, err)
+
+	// Test: Chunk data longer than chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.Error(t, err)
+
+	// Test: Missing terminating chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.Error(t, err)
+}
+
+func TestChunkedTrailersParse(t *testing.T) {
+	// Test: Announced trailers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Content-Sha256, X-Content-Length\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"X-Content-Sha256: 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824\r\n" +
+			"X-Content-Length: 5\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", get(r.Trailers, "x-content-sha256"))
+	assert.Equal(t, "5", get(r.Trailers, "x-content-length"))
+
+	// Test: No trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Empty(t, r.Trailers)
+
+	// Test: Trailer not announced
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Content-Length\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"X-Content-Sha256: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.Error(t, err)
+
+	// Test: Malformed trailer
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Content-Length\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"X-Content-Length 5\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.Error(t, err)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Headers are returned before the body is read
+	data := "POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Length: 64\r\n" +
+		"\r\n" +
+		strings.Repeat("a", 64)
+	reader := &chunkReader{
+		data:            data,
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Less(t, reader.pos, len(data))
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 64), string(body))
+	assert.Equal(t, len(data), reader.pos)
+
+	// Test: Small reads from a chunked body
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"6\r\n world\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 5,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	p := make([]byte, 2)
+	var got []byte
+	for {
+		n, err := r.Body.Read(p)
+		got = append(got, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "hello world", string(got))
+
+	// Test: BodyBytes can be called more than once
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	body, err = r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Reading a closed body fails
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	_, err = r.Body.Read(p)
+	require.Error(t, err)
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Leftover bytes are carried into the next request
+	reader := NewReader(&chunkReader{
+		data: "POST /one HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /two HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n" +
+			"POST /three HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nabc\r\n0\r\n\r\n",
+		numBytesPerRead: 64,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.RequestLine.RequestTarget)
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.RequestTarget)
+
+	// the body of /three is never read, so it must be skipped by the next call
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/three", r.RequestLine.RequestTarget)
+
+	_, err = reader.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Wait skips the unread body and stops at the next request
+	reader = NewReader(&chunkReader{
+		data: "POST /one HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /two HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	})
+	require.NoError(t, reader.Wait())
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.RequestLine.RequestTarget)
+	require.NoError(t, reader.Wait())
+	require.NoError(t, reader.Wait())
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.RequestTarget)
+	require.ErrorIs(t, reader.Wait(), io.EOF)
+
+	// Test: Empty lines before a request line are ignored
+	for _, numBytesPerRead := range []int{1, 64} {
+		reader = NewReader(&chunkReader{
+			data: "\r\nPOST /one HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Content-Length: 5\r\n" +
+				"\r\n" +
+				"hello\r\n\r\n" +
+				"GET /two HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"\r\n\r\n",
+			numBytesPerRead: numBytesPerRead,
+		})
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/one", r.RequestLine.RequestTarget)
+		r, err = reader.ReadRequest()
+		require.NoError(t, err)
+		assert.Equal(t, "/two", r.RequestLine.RequestTarget)
+		_, err = reader.ReadRequest()
+		require.ErrorIs(t, err, io.EOF)
+	}
+
+	// Test: Connection persistence
+	reader = NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	reader = NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n"))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+
+	reader = NewReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: keep-alive, Close\r\n\r\n"))
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.KeepAlive())
+}
+
+func TestRequestTargetParse(t *testing.T) {
+	// Test: Origin-form with query string
+	r, err := RequestFromReader(strings.NewReader("GET /video?x=1&tag=a&tag=b%20c&q=go+lang HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, OriginForm, r.Target.Form)
+	assert.Equal(t, "/video", r.Target.Path)
+	assert.Equal(t, "/video", r.Target.RawPath)
+	assert.Equal(t, "x=1&tag=a&tag=b%20c&q=go+lang", r.Target.RawQuery)
+	assert.Equal(t, "1", r.Target.Query.Get("x"))
+	assert.Equal(t, []string{"a", "b c"}, r.Target.Query["tag"])
+	assert.Equal(t, "go lang", r.Target.Query.Get("q"))
+	assert.False(t, r.Target.Query.Has("missing"))
+
+	// Test: Percent-encoded path
+	r, err = RequestFromReader(strings.NewReader("GET /files/my%20doc%2Ftxt HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/files/my doc/txt", r.Target.Path)
+	assert.Equal(t, "/files/my%20doc%2Ftxt", r.Target.RawPath)
+
+	// Test: Absolute-form
+	r, err = RequestFromReader(strings.NewReader("GET http://example.com:8080/a/b?c=d HTTP/1.1\r\nHost: example.com:8080\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, AbsoluteForm, r.Target.Form)
+	assert.Equal(t, "http", r.Target.Scheme)
+	assert.Equal(t, "example.com:8080", r.Target.Authority)
+	assert.Equal(t, "/a/b", r.Target.Path)
+	assert.Equal(t, "d", r.Target.Query.Get("c"))
+
+	// Test: Absolute-form without a path
+	r, err = RequestFromReader(strings.NewReader("GET http://example.com HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "/", r.Target.Path)
+
+	// Test: Authority-form
+	r, err = RequestFromReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, AuthorityForm, r.Target.Form)
+	assert.Equal(t, "example.com:443", r.Target.Authority)
+
+	// Test: Asterisk-form
+	r, err = RequestFromReader(strings.NewReader("OPTIONS * HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, AsteriskForm, r.Target.Form)
+
+	// Test: Asterisk-form with a method other than OPTIONS
+	_, err = RequestFromReader(strings.NewReader("GET * HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Malformed percent-escapes
+	_, err = RequestFromReader(strings.NewReader("GET /bad%zzpath HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+	_, err = RequestFromReader(strings.NewReader("GET /bad%2 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+	_, err = RequestFromReader(strings.NewReader("GET /ok?q=%G1 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Fragment in request target
+	_, err = RequestFromReader(strings.NewReader("GET /page#section HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Authority-form without a port
+	_, err = RequestFromReader(strings.NewReader("CONNECT example.com HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Relative target
+	_, err = RequestFromReader(strings.NewReader("GET coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+}
+
+func TestHTTPVersionParse(t *testing.T) {
+	// Test: HTTP/1.0 request
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.Equal(t, 1, r.RequestLine.VersionMajor)
+	assert.Equal(t, 0, r.RequestLine.VersionMinor)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 request asking for keep-alive
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.0\r\nHost: localhost:42069\r\nConnection: Keep-Alive\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.1 request
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, 1, r.RequestLine.VersionMajor)
+	assert.Equal(t, 1, r.RequestLine.VersionMinor)
+
+	// Test: Version without a slash
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP\r\nHost: localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedVersion)
+
+	// Test: Malformed versions
+	for _, v := range []string{"HTTP/", "HTTP/1", "HTTP/1.", "HTTP/11", "http/1.1", "HTTP/1.1.1", "HTTP/a.b"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + v + "\r\nHost: localhost:42069\r\n\r\n"))
+		require.Error(t, err, v)
+		assert.NotErrorIs(t, err, ErrUnsupportedVersion, v)
+	}
+
+	// Test: Unsupported versions
+	for _, v := range []string{"HTTP/2.0", "HTTP/0.9", "HTTP/1.2"} {
+		_, err = RequestFromReader(strings.NewReader("GET / " + v + "\r\nHost: localhost:42069\r\n\r\n"))
+		require.ErrorIs(t, err, ErrUnsupportedVersion, v)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineLength: 32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       3,
+		MaxBodySize:          10,
+	}
+	read := func(data string) (*Request, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		return reader.ReadRequest()
+	}
+
+	// Test: Request within limits
+	r, err := read("POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Request line too long
+	_, err = read("GET /" + strings.Repeat("a", 64) + " HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Request line too long without a CRLF
+	_, err = read("GET /" + strings.Repeat("a", 64))
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Header bytes exceeded
+	_, err = read("GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 100) + "\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Header count exceeded
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderFieldsTooLarge)
+
+	// Test: Content-Length exceeds body limit
+	_, err = read("POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body exceeds body limit
+	r, err = read("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Zero limits are unlimited
+	reader := NewReader(strings.NewReader("GET /" + strings.Repeat("a", 20000) + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	reader.Limits = Limits{}
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"missing version", "GET /\r\n\r\n", ErrMalformedRequestLine},
+		{"malformed version", "GET / HTTP/x\r\n\r\n", ErrMalformedRequestLine},
+		{"lowercase method", "get / HTTP/1.1\r\n\r\n", ErrInvalidMethod},
+		{"empty method", " / HTTP/1.1\r\n\r\n", ErrInvalidMethod},
+		{"bad target", "GET /%zz HTTP/1.1\r\n\r\n", ErrInvalidTarget},
+		{"unsupported version", "GET / HTTP/3.0\r\n\r\n", ErrUnsupportedVersion},
+		{"missing colon", "GET / HTTP/1.1\r\nHost localhost\r\n\r\n", headers.ErrMalformedFieldLine},
+		{"bad field name", "GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n", headers.ErrInvalidFieldName},
+		{"bad content length", "POST / HTTP/1.1\r\nContent-Length: abc\r\n\r\n", ErrInvalidContentLength},
+		{"truncated headers", "GET / HTTP/1.1\r\nHost: localhost\r\n", ErrIncompleteRequest},
+	}
+	for _, c := range cases {
+		_, err := RequestFromReader(strings.NewReader(c.data))
+		require.ErrorIs(t, err, c.err, c.name)
+	}
+
+	// Test: Body errors
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n"))
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.ErrorIs(t, err, ErrMalformedChunk)
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Secret: 1\r\n\r\n"))
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.ErrorIs(t, err, ErrInvalidTrailer)
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort"))
+	require.NoError(t, err)
+	_, err = r.BodyBytes()
+	require.ErrorIs(t, err, ErrIncompleteRequest)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"))
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+	_, err = r.Body.Read(make([]byte, 5))
+	require.ErrorIs(t, err, ErrBodyClosed)
+}
+
+const browserRequest = "GET /static/app.js?v=3 HTTP/1.1\r\n" +
+	"Host: localhost:42069\r\n" +
+	"Connection: keep-alive\r\n" +
+	"sec-ch-ua: \"Chromium\";v=\"124\", \"Google Chrome\";v=\"124\", \"Not-A.Brand\";v=\"99\"\r\n" +
+	"sec-ch-ua-mobile: ?0\r\n" +
+	"User-Agent: Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36\r\n" +
+	"sec-ch-ua-platform: \"Linux\"\r\n" +
+	"Accept: */*\r\n" +
+	"Sec-Fetch-Site: same-origin\r\n" +
+	"Sec-Fetch-Mode: no-cors\r\n" +
+	"Sec-Fetch-Dest: script\r\n" +
+	"Referer: http://localhost:42069/\r\n" +
+	"Accept-Encoding: gzip, deflate, br, zstd\r\n" +
+	"Accept-Language: en-US,en;q=0.9\r\n" +
+	"Cookie: session=2f1c9a7e; theme=dark\r\n" +
+	"\r\n"
+
+func BenchmarkRequestFromReader(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(browserRequest)))
+	reader := strings.NewReader(browserRequest)
+	for b.Loop() {
+		reader.Reset(browserRequest)
+		if _, err := RequestFromReader(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPipelinedRequests(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(browserRequest)))
+	data := strings.Repeat(browserRequest, 64)
+	src := strings.NewReader(data)
+	reader := NewReader(src)
+	for b.Loop() {
+		r, err := reader.ReadRequest()
+		if err == io.EOF {
+			src.Reset(data)
+			reader = NewReader(src)
+			r, err = reader.ReadRequest()
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = r
+	}
 }
@@ -0,0 +1,108 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CodeZeroSugar/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Known request smuggling payloads. Each one must be rejected outright, since
+// a proxy in front of the server could frame it differently.
+func TestSmugglingHeaderPayloads(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"CL.CL conflicting", "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 7\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL list conflicting", "POST / HTTP/1.1\r\nContent-Length: 5, 7\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL.TE", "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrConflictingFraming},
+		{"TE.CL", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n0\r\n\r\n", ErrConflictingFraming},
+		{"CL plus sign", "POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL negative", "POST / HTTP/1.1\r\nContent-Length: -5\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL hex", "POST / HTTP/1.1\r\nContent-Length: 0x5\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL inner space", "POST / HTTP/1.1\r\nContent-Length: 5 5\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL empty element", "POST / HTTP/1.1\r\nContent-Length: 5,\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL empty", "POST / HTTP/1.1\r\nContent-Length:\r\n\r\nhello", ErrInvalidContentLength},
+		{"CL overflow", "POST / HTTP/1.1\r\nContent-Length: 99999999999999999999999\r\n\r\nhello", ErrInvalidContentLength},
+		{"TE unknown coding", "POST / HTTP/1.1\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE gzip before chunked", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", ErrUnsupportedTransferCoding},
+		{"TE chunked not last", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE quoted", "POST / HTTP/1.1\r\nTransfer-Encoding: \"chunked\"\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE vertical tab", "POST / HTTP/1.1\r\nTransfer-Encoding:\x0bchunked\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE.TE duplicated", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE.TE obfuscated", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE empty", "POST / HTTP/1.1\r\nTransfer-Encoding: ,\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE in HTTP/1.0", "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrInvalidTransferEncoding},
+		{"TE space before colon", "POST / HTTP/1.1\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n", headers.ErrInvalidFieldName},
+		{"CL space before colon", "POST / HTTP/1.1\r\nContent-Length : 5\r\n\r\nhello", headers.ErrInvalidFieldName},
+		{"TE obs-fold", "POST / HTTP/1.1\r\nX-Padding: a\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n", headers.ErrObsoleteLineFold},
+		{"TE value obs-fold", "POST / HTTP/1.1\r\nTransfer-Encoding:\r\n chunked\r\n\r\n0\r\n\r\n", headers.ErrObsoleteLineFold},
+		{"bare LF in field value", "POST / HTTP/1.1\r\nX-A: a\nContent-Length: 5\r\n\r\nhello", headers.ErrInvalidFieldValue},
+		{"bare CR in field value", "POST / HTTP/1.1\r\nX-A: a\rContent-Length: 5\r\n\r\nhello", headers.ErrInvalidFieldValue},
+		{"NUL in field value", "POST / HTTP/1.1\r\nX-A: a\x00\r\nContent-Length: 5\r\n\r\nhello", headers.ErrInvalidFieldValue},
+		{"bare LF in request line", "GET / HTTP/1.1\nHost: localhost\r\n\r\n", ErrMalformedRequestLine},
+	}
+	for _, c := range cases {
+		reader := &chunkReader{data: c.data, numBytesPerRead: 3}
+		_, err := RequestFromReader(reader)
+		require.ErrorIs(t, err, c.err, c.name)
+	}
+}
+
+func TestSmugglingBodyPayloads(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"chunk size hex prefix", "0x5\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk size plus sign", "+5\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk size negative", "-5\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk size leading space", " 5\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk size overflow", "fffffffffffffffff5\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk size bare LF", "5\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk extension bare LF", "5;a\nb\r\nhello\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"chunk data overrun", "5\r\nhelloXX\r\n0\r\n\r\n", ErrMalformedChunk},
+		{"forbidden trailer", "0\r\nContent-Length: 5\r\n\r\n", ErrInvalidTrailer},
+	}
+	for _, c := range cases {
+		reader := &chunkReader{
+			data: "POST / HTTP/1.1\r\n" +
+				"Host: localhost\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"Trailer: Content-Length\r\n" +
+				"\r\n" + c.data,
+			numBytesPerRead: 3,
+		}
+		r, err := RequestFromReader(reader)
+		require.NoError(t, err, c.name)
+		_, err = r.BodyBytes()
+		require.ErrorIs(t, err, c.err, c.name)
+	}
+}
+
+func TestUnambiguousFraming(t *testing.T) {
+	// Test: Repeated identical Content-Length values
+	for _, data := range []string{
+		"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nContent-Length: 5, 5\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nContent-Length:\t5\t\r\n\r\nhello",
+	} {
+		r, err := RequestFromReader(strings.NewReader(data))
+		require.NoError(t, err)
+		body, err := r.BodyBytes()
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+	}
+
+	// Test: Transfer-Encoding is matched case-insensitively
+	r, err := RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	body, err := r.BodyBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
@@ -0,0 +1,224 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms from RFC 9112 §3.2.
+type TargetForm int
+
+const (
+	OriginForm    TargetForm = 0
+	AbsoluteForm  TargetForm = 1
+	AuthorityForm TargetForm = 2
+	AsteriskForm  TargetForm = 3
+)
+
+// Query holds the decoded query parameters of a request-target. A key may
+// appear more than once, so every value is kept in the order it was sent. It
+// is nil when the target has no query.
+type Query map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (q Query) Get(key string) string {
+	values := q[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Has reports whether key appeared in the query string.
+func (q Query) Has(key string) bool {
+	_, exists := q[key]
+	return exists
+}
+
+// Target is the parsed form of RequestLine.RequestTarget.
+type Target struct {
+	Form      TargetForm
+	Scheme    string
+	Authority string
+	RawPath   string
+	Path      string
+	RawQuery  string
+	Query     Query
+}
+
+func parseTarget(method, target string) (Target, error) {
+	if len(target) == 0 {
+		return Target{}, errors.New("request target is empty")
+	}
+	for i := 0; i < len(target); i++ {
+		c := target[i]
+		if c <= ' ' || c == 0x7f {
+			return Target{}, fmt.Errorf("invalid character %q in request target", c)
+		}
+		if c == '#' {
+			return Target{}, errors.New("request target must not contain a fragment")
+		}
+	}
+
+	switch {
+	case target == "*":
+		if method != "OPTIONS" {
+			return Target{}, errors.New("asterisk-form is only allowed for OPTIONS requests")
+		}
+		return Target{Form: AsteriskForm}, nil
+
+	case method == "CONNECT":
+		host, port, found := strings.Cut(target, ":")
+		if !found || len(host) == 0 || len(port) == 0 || strings.ContainsAny(target, "/?@") {
+			return Target{}, fmt.Errorf("invalid authority-form target '%s'", target)
+		}
+		return Target{Form: AuthorityForm, Authority: target}, nil
+
+	case target[0] == '/':
+		t := Target{Form: OriginForm}
+		if err := t.setPathAndQuery(target); err != nil {
+			return Target{}, err
+		}
+		return t, nil
+
+	default:
+		return parseAbsoluteTarget(target)
+	}
+}
+
+func parseAbsoluteTarget(target string) (Target, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("invalid request target '%s'", target)
+	}
+	end := strings.IndexAny(rest, "/?")
+	if end == -1 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	if len(authority) == 0 {
+		return Target{}, fmt.Errorf("absolute-form target '%s' has no authority", target)
+	}
+	pathAndQuery := rest[end:]
+	if len(pathAndQuery) == 0 || pathAndQuery[0] == '?' {
+		pathAndQuery = "/" + pathAndQuery
+	}
+
+	t := Target{
+		Form:      AbsoluteForm,
+		Scheme:    strings.ToLower(scheme),
+		Authority: authority,
+	}
+	if err := t.setPathAndQuery(pathAndQuery); err != nil {
+		return Target{}, err
+	}
+	return t, nil
+}
+
+func (t *Target) setPathAndQuery(s string) error {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return fmt.Errorf("invalid path '%s': %w", rawPath, err)
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("invalid query '%s': %w", rawQuery, err)
+	}
+	t.RawPath = rawPath
+	t.Path = path
+	t.RawQuery = rawQuery
+	t.Query = query
+	return nil
+}
+
+func parseQuery(rawQuery string) (Query, error) {
+	if len(rawQuery) == 0 {
+		return nil, nil
+	}
+	query := Query{}
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if len(pair) == 0 {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		query[key] = append(query[key], value)
+	}
+	return query, nil
+}
+
+func validScheme(scheme string) bool {
+	if len(scheme) == 0 || !isAlpha(scheme[0]) {
+		return false
+	}
+	for i := 1; i < len(scheme); i++ {
+		c := scheme[i]
+		if !isAlpha(c) && !isDigit(c) && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// UnescapePath decodes the percent-encoded octets of a path, or of one of its
+// segments, as Target.Path is decoded from Target.RawPath.
+func UnescapePath(s string) (string, error) {
+	return unescape(s, false)
+}
+
+// unescape decodes percent-encoded octets in s. In query components a '+'
+// stands for a space.
+func unescape(s string, plusAsSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", fmt.Errorf("malformed percent-escape at offset %d", i)
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case c == '+' && plusAsSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
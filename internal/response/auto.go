@@ -0,0 +1,115 @@
+package response
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/CodeZeroSugar/internal/headers"
+)
+
+// autoBufferSize is how much of the body Write holds back before it gives up
+// on sending a Content-Length and switches to chunked encoding.
+const autoBufferSize = 4096
+
+// The methods in this file let a handler use the Writer as an io.Writer instead
+// of calling WriteStatusLine, WriteHeaders and WriteBody itself. The handler
+// sets the status and header fields, then writes the body; the first
+// autoBufferSize bytes are buffered, and Finish, which the server calls once
+// the handler returns, sends them with a Content-Length. A body that outgrows
+// the buffer is sent chunked instead. Either way the body is terminated
+// correctly without the handler doing anything.
+
+// Header returns the header fields sent with the response when it is framed
+// automatically or when WriteBody implies the header section. Changes made
+// after the first part of the body has been sent have no effect.
+func (w *Writer) Header() *headers.Headers {
+	return &w.header
+}
+
+// SetStatus sets the status code sent when the status line is not written
+// explicitly, either because the response is framed automatically or because
+// WriteHeaders or WriteBody implies it. It defaults to 200.
+func (w *Writer) SetStatus(statusCode StatusCode) {
+	w.status = statusCode
+}
+
+// Write implements io.Writer. Called before WriteStatusLine, it frames the
+// response automatically; after WriteHeaders it writes p as the next part of
+// the body, as a chunk if the response is chunked.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.writerState != StatusLine {
+		return w.writeBodyPart(p)
+	}
+	if len(w.buf)+len(p) <= autoBufferSize {
+		w.buf = append(w.buf, p...)
+		return len(p), nil
+	}
+
+	if _, hasLength := w.header.Get("Content-Length"); !hasLength {
+		w.header.Set("Transfer-Encoding", "chunked")
+	}
+	if err := w.WriteHeaders(w.header); err != nil {
+		return 0, err
+	}
+	body := append(w.buf, p...)
+	w.buf = nil
+	if _, err := w.writeBodyPart(body); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeBodyPart writes p as the next part of the body, framing it as a chunk
+// when the response is chunked.
+func (w *Writer) writeBodyPart(p []byte) (int, error) {
+	if !w.chunked && !w.chunkedFallback {
+		return w.WriteBody(p)
+	}
+	return w.WriteChunkedBody(p)
+}
+
+// Finish completes the response: an automatically framed body that fit in the
+// buffer is sent with a Content-Length, or as a single chunk if the handler
+// set a Transfer-Encoding, and a chunked body that was not terminated, however
+// it was written, is terminated without trailers. A handler that wrote nothing
+// at all gets an empty 200 response, and one that stopped after the status
+// line gets the fields set through Header and an empty body. In every case
+// the buffered output is flushed to the connection.
+func (w *Writer) Finish() error {
+	err := w.finish()
+	if releaseErr := w.release(); err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+func (w *Writer) finish() error {
+	if w.writerState != Body {
+		_, hasLength := w.header.Get("Content-Length")
+		_, hasEncoding := w.header.Get("Transfer-Encoding")
+		if !hasLength && !hasEncoding {
+			w.header.Set("Content-Length", strconv.Itoa(len(w.buf)))
+		}
+		if err := w.WriteHeaders(w.header); err != nil {
+			return err
+		}
+		body := w.buf
+		w.buf = nil
+		if _, err := w.writeBodyPart(body); err != nil {
+			return err
+		}
+	}
+	if !w.chunked || w.chunkedDone || w.noBody() {
+		return nil
+	}
+	if !w.lastChunk {
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+	}
+	if err := w.writeString("\r\n"); err != nil {
+		return fmt.Errorf("failed to end chunked body: %w", err)
+	}
+	w.chunkedDone = true
+	return nil
+}
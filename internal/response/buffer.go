@@ -0,0 +1,79 @@
+package response
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// bufferSize is the size of the buffer a response is collected in before it
+// is written to the connection.
+const bufferSize = 4096
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriterSize(nil, bufferSize)
+	},
+}
+
+// connWriter passes writes through to the connection and records whether any
+// were made.
+type connWriter struct {
+	w    io.Writer
+	sent bool
+}
+
+func (c *connWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		c.sent = true
+	}
+	return c.w.Write(p)
+}
+
+// buffered returns the buffer the response is written to, taking one from the
+// pool on first use.
+func (w *Writer) buffered() *bufio.Writer {
+	if w.bw == nil {
+		w.bw = bufferPool.Get().(*bufio.Writer)
+		w.bw.Reset(&w.conn)
+	}
+	return w.bw
+}
+
+func (w *Writer) writeString(s string) error {
+	_, err := w.buffered().WriteString(s)
+	return err
+}
+
+// Flush writes any buffered part of the response to the connection. Handlers
+// that stream a body, such as a proxy relaying chunks as they arrive, call it
+// to send what they have so far without waiting for the response to end.
+func (w *Writer) Flush() error {
+	if w.bw == nil {
+		return nil
+	}
+	if err := w.bw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush response: %w", err)
+	}
+	return nil
+}
+
+// release flushes the buffer and returns it to the pool.
+func (w *Writer) release() error {
+	err := w.Flush()
+	w.Abort()
+	return err
+}
+
+// Abort discards the part of the response that is still buffered, without
+// completing it, and returns the buffer to the pool. The server uses it to
+// drop a response whose handler failed; the connection must then be closed.
+func (w *Writer) Abort() {
+	if w.bw != nil {
+		w.bw.Reset(io.Discard)
+		bufferPool.Put(w.bw)
+		w.bw = nil
+	}
+	w.buf = nil
+}
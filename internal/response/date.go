@@ -0,0 +1,30 @@
+package response
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeZeroSugar/internal/headers"
+)
+
+// now is the clock used for the Date header; tests replace it.
+var now = time.Now
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+// dateCache holds the last formatted Date value, so a busy server formats it
+// once per second instead of once per response.
+var dateCache atomic.Pointer[cachedDate]
+
+func httpDate(t time.Time) string {
+	unix := t.Unix()
+	if c := dateCache.Load(); c != nil && c.unix == unix {
+		return c.value
+	}
+	c := &cachedDate{unix: unix, value: headers.FormatTime(t)}
+	dateCache.Store(c)
+	return c.value
+}
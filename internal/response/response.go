@@ -1,10 +1,12 @@
 package response
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/CodeZeroSugar/internal/headers"
 )
@@ -17,123 +19,424 @@ const (
 	Body       WriterState = 2
 )
 
-type StatusCode int
+// ErrContentLengthExceeded is returned, wrapped, for body writes that would
+// send more bytes than the Content-Length of the response declares.
+var ErrContentLengthExceeded = errors.New("body exceeds Content-Length")
 
-const (
-	StatusCodeOK                  StatusCode = 200
-	StatusCodeBadRequest          StatusCode = 400
-	StatusCodeInternalServerError StatusCode = 500
-)
+// ErrBodyDone is returned, wrapped, for body writes after the last chunk of a
+// chunked body.
+var ErrBodyDone = errors.New("body already ended")
 
 type Writer struct {
-	conn        io.Writer
+	conn        connWriter
+	bw          *bufio.Writer
 	writerState WriterState
+	version     string
+	method      string
+	statusCode  StatusCode
+
+	keepAlive          bool
+	preserveHeaderCase bool
+	server             string
+	chunkedFallback    bool
+	contentLength      int
+	bodyWritten        int
+	chunked            bool
+	lastChunk          bool
+	chunkedDone        bool
+
+	status StatusCode
+	header headers.Headers
+	buf    []byte
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		conn:        w,
-		writerState: StatusLine,
+		conn:          connWriter{w: w},
+		writerState:   StatusLine,
+		version:       "1.1",
+		contentLength: -1,
+	}
+}
+
+// SetVersion sets the HTTP version ("1.0" or "1.1") of the request being
+// answered. Responses to HTTP/1.0 requests use that version in the status
+// line, and chunked bodies are sent unframed and delimited by closing the
+// connection, since HTTP/1.0 clients do not understand chunked encoding.
+func (w *Writer) SetVersion(version string) {
+	w.version = version
+}
+
+// SetMethod sets the method of the request being answered. Responses to HEAD
+// carry the same header fields as for GET, but the writer discards every body
+// byte written to them.
+func (w *Writer) SetMethod(method string) {
+	w.method = method
+}
+
+// SetKeepAlive tells the writer whether the connection may be reused after
+// this response. It must be called before WriteHeaders; when false, a
+// Connection: close header is added to the response.
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetServer sets the value of the Server field added to the response. No
+// Server field is sent when it is empty, which is the default.
+func (w *Writer) SetServer(server string) {
+	w.server = server
+}
+
+// SetPreserveHeaderCase makes WriteHeaders and WriteTrailers send field names
+// exactly as they are spelled in the given Headers instead of in canonical
+// form, which a proxy needs to forward fields unchanged.
+func (w *Writer) SetPreserveHeaderCase(preserve bool) {
+	w.preserveHeaderCase = preserve
+}
+
+func (w *Writer) fieldName(key string) string {
+	if w.preserveHeaderCase {
+		return key
+	}
+	return headers.CanonicalKey(key)
+}
+
+// KeepAlive reports whether a complete, correctly framed response was written
+// and the connection can be used for another request.
+func (w *Writer) KeepAlive() bool {
+	if !w.keepAlive || w.writerState != Body || w.statusCode == StatusCodeSwitchingProtocols {
+		return false
 	}
+	if w.noBody() {
+		return true
+	}
+	if w.chunked {
+		return w.chunkedDone
+	}
+	return w.contentLength >= 0 && w.bodyWritten == w.contentLength
+}
+
+// Status returns the status code of the response: the one in the status line
+// if it has been written, or else the one it will be written with.
+func (w *Writer) Status() StatusCode {
+	if w.statusCode != 0 {
+		return w.statusCode
+	}
+	return w.statusOrOK()
+}
+
+// Sent reports whether any part of the response has reached the connection,
+// after which it can no longer be replaced by another response.
+func (w *Writer) Sent() bool {
+	return w.conn.sent
+}
+
+// BytesWritten returns the number of body bytes written so far, not counting
+// chunk framing. Bytes written to a HEAD or 204 response count even though
+// they are discarded, and so do bytes still held back by automatic framing.
+func (w *Writer) BytesWritten() int {
+	return w.bodyWritten + len(w.buf)
+}
+
+// noBody reports whether the response must not have a body, because it
+// answers a HEAD request or because of its status code.
+func (w *Writer) noBody() bool {
+	return w.method == "HEAD" || !bodyAllowed(w.statusCode)
 }
 
 func (w *Writer) WriteTrailers(h headers.Headers) error {
-	if len(h) == 0 {
+	if w.chunkedFallback {
+		return nil
+	}
+	if w.chunkedDone {
+		return fmt.Errorf("tried to write trailers: %w", ErrBodyDone)
+	}
+	if w.noBody() {
+		w.chunkedDone = true
+		return nil
+	}
+	if h.Len() == 0 {
 		return errors.New("tried to write trailers but none exist")
 	}
-	for key, value := range h {
-		payload := fmt.Sprintf("%s: %s\r\n", key, value)
-		_, err := w.conn.Write([]byte(payload))
-		if err != nil {
+	if err := h.Validate(); err != nil {
+		return fmt.Errorf("refusing to write trailers: %w", err)
+	}
+	for key, value := range h.All() {
+		if err := w.writeField(key, value); err != nil {
 			return fmt.Errorf("failed to write trailers: %w", err)
 		}
 	}
-	_, err := w.conn.Write([]byte("\r\n"))
-	if err != nil {
+	if err := w.writeString("\r\n"); err != nil {
 		return fmt.Errorf("failed to write newline after trailers: %w", err)
 	}
+	w.chunkedDone = true
 	return nil
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
-	hexString := fmt.Sprintf("%02X\r\n", len(p))
-	hexBytes := []byte(hexString)
-	hexBytes = append(hexBytes, p...)
-	hexBytes = append(hexBytes, "\r\n"...)
-	_, err := w.WriteBody(hexBytes)
-	if err != nil {
+	if w.chunkedFallback {
+		return w.WriteBody(p)
+	}
+	if w.writerState != Body {
+		return 0, fmt.Errorf("tried to write chunked body while state was: %v", w.writerState)
+	}
+	if w.lastChunk || w.chunkedDone {
+		return 0, fmt.Errorf("tried to write chunked body: %w", ErrBodyDone)
+	}
+	// An empty chunk would be the last-chunk and end the body.
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.bodyWritten += len(p)
+	if w.noBody() {
+		return len(p), nil
+	}
+	bw := w.buffered()
+	fmt.Fprintf(bw, "%02X\r\n", len(p))
+	bw.Write(p)
+	if _, err := bw.WriteString("\r\n"); err != nil {
 		return 0, fmt.Errorf("failed to write chunked body: %w", err)
 	}
 	return len(p), nil
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if w.chunkedFallback {
+		return 0, nil
+	}
+	if w.lastChunk || w.chunkedDone {
+		return 0, fmt.Errorf("tried to end chunked body: %w", ErrBodyDone)
+	}
+	if w.noBody() {
+		w.lastChunk = true
+		return 0, nil
+	}
+	if w.writerState != Body {
+		return 0, fmt.Errorf("tried to write chunked body while state was: %v", w.writerState)
+	}
 	chunkDone := "0\r\n"
-	n, err := w.WriteBody([]byte(chunkDone))
-	if err != nil {
+	if err := w.writeString(chunkDone); err != nil {
 		return 0, fmt.Errorf("failed to write chunked body as done: %w", err)
 	}
-	return n, nil
+	w.lastChunk = true
+	return len(chunkDone), nil
 }
 
+// WriteStatusLine writes the status line with the registered reason phrase for
+// statusCode, or an empty one if the code is not registered.
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	if w.writerState == StatusLine {
-		var reason string
-		switch statusCode {
-		case StatusCodeOK:
-			reason = "OK"
-		case StatusCodeBadRequest:
-			reason = "Bad Request"
-		case StatusCodeInternalServerError:
-			reason = "Internal Server Error"
-		default:
-			reason = ""
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase,
+// such as the one sent by an upstream server whose response is proxied.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
+	if w.writerState != StatusLine {
+		return fmt.Errorf("tried to write status line while state was: %v", w.writerState)
+	}
+	if statusCode < 100 || statusCode > 999 {
+		return fmt.Errorf("status code %d is not three digits", statusCode)
+	}
+	for i := 0; i < len(reason); i++ {
+		if c := reason[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("invalid character %q in reason phrase", c)
+		}
+	}
+	_, err := fmt.Fprintf(w.buffered(), "HTTP/%s %d %s\r\n", w.version, statusCode, reason)
+	if err != nil {
+		return fmt.Errorf("failed to write status line: %w", err)
+	}
+	w.statusCode = statusCode
+	w.writerState = Headers
+	return nil
+}
+
+// WriteHeaders writes the header section. If the status line has not been
+// written yet, it is written first with the status set by SetStatus, or 200.
+// Connection, Date and Server fields are added unless h already has them.
+func (w *Writer) WriteHeaders(h headers.Headers) error {
+	implied := w.writerState == StatusLine
+	if !implied && w.writerState != Headers {
+		return fmt.Errorf("tried to write headers while state was: %v", w.writerState)
+	}
+	if err := h.Validate(); err != nil {
+		return fmt.Errorf("refusing to write headers: %w", err)
+	}
+	if implied {
+		// The framing rules depend on the status, so it is recorded now, but
+		// the status line is only written once every field is known to be
+		// valid, so an invalid field leaves nothing written.
+		w.statusCode = w.statusOrOK()
+	}
+	generated := w.generatedHeaders(h)
+	if err := generated.Validate(); err != nil {
+		if implied {
+			w.statusCode = 0
+		}
+		return fmt.Errorf("refusing to write headers: %w", err)
+	}
+	if implied {
+		if err := w.WriteStatusLine(w.statusCode); err != nil {
+			w.statusCode = 0
+			return err
+		}
+	}
+	for key, value := range generated.All() {
+		if err := w.writeField(key, value); err != nil {
+			return err
 		}
-		line := fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, reason)
-		_, err := w.conn.Write([]byte(line))
-		if err != nil {
-			return fmt.Errorf("failed to write status line: %w", err)
+	}
+	for key, value := range h.All() {
+		if (w.chunkedFallback || !framingAllowed(w.statusCode)) && isFramingHeader(key) {
+			continue
 		}
-		w.writerState = Headers
+		if err := w.writeField(key, value); err != nil {
+			return err
+		}
+	}
+	if err := w.writeString("\r\n"); err != nil {
+		return fmt.Errorf("failed to add blank line before body:%w", err)
+	}
+	if isInterim(w.statusCode) {
+		if w.status == w.statusCode {
+			w.status = 0
+		}
+		w.statusCode = 0
+		w.contentLength = -1
+		w.writerState = StatusLine
 		return nil
 	}
-	return fmt.Errorf("tried to write status line while state was: %v", w.writerState)
+	w.writerState = Body
+	return nil
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
-	if w.writerState == Headers {
-		for key, value := range headers {
-			payload := key + ": " + value + "\r\n"
-			_, err := w.conn.Write([]byte(payload))
-			if err != nil {
-				return fmt.Errorf("failed to write '%s' for headers: %w", payload, err)
-			}
+// generatedHeaders returns the fields the writer adds to h on its own.
+func (w *Writer) generatedHeaders(h headers.Headers) headers.Headers {
+	generated := headers.NewHeaders()
+	if hasConnection := w.readFraming(h); !hasConnection {
+		if !w.keepAlive {
+			generated.Add("Connection", "close")
+		} else if w.version == "1.0" {
+			generated.Add("Connection", "keep-alive")
 		}
-		_, err := w.conn.Write([]byte("\r\n"))
-		if err != nil {
-			return fmt.Errorf("failed to add blank line before body:%w", err)
+	}
+	if _, exists := h.Get("Date"); !exists {
+		generated.Add("Date", httpDate(now()))
+	}
+	if _, exists := h.Get("Server"); !exists && w.server != "" {
+		generated.Add("Server", w.server)
+	}
+	return generated
+}
+
+// writeField writes a single field line. bufio.Writer keeps the first error it
+// hits, so only the last write needs checking.
+func (w *Writer) writeField(key, value string) error {
+	bw := w.buffered()
+	bw.WriteString(w.fieldName(key))
+	bw.WriteString(": ")
+	bw.WriteString(value)
+	if _, err := bw.WriteString("\r\n"); err != nil {
+		return fmt.Errorf("failed to write field '%s': %w", key, err)
+	}
+	return nil
+}
+
+// readFraming records how the body described by h is delimited, and turns off
+// keep-alive when the handler asked for it or when the body can only be
+// delimited by closing the connection. It reports whether h already contains
+// a Connection header.
+func (w *Writer) readFraming(h headers.Headers) bool {
+	hasConnection := false
+	for key, value := range h.All() {
+		switch strings.ToLower(key) {
+		case "content-length":
+			if n, err := strconv.Atoi(value); err == nil {
+				w.contentLength = n
+			}
+		case "transfer-encoding":
+			codings := strings.Split(value, ",")
+			w.chunked = strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+		case "connection":
+			hasConnection = true
+			for _, option := range strings.Split(value, ",") {
+				if strings.EqualFold(strings.TrimSpace(option), "close") {
+					w.keepAlive = false
+				}
+			}
 		}
-		w.writerState = Body
-		return nil
 	}
-	return fmt.Errorf("tried to write headers while state was: %v", w.writerState)
+	if !framingAllowed(w.statusCode) {
+		w.chunked = false
+		w.contentLength = -1
+	}
+	if w.chunked && w.version == "1.0" {
+		w.chunked = false
+		w.chunkedFallback = true
+		w.contentLength = -1
+	}
+	if !w.chunked && w.contentLength < 0 && !w.noBody() {
+		w.keepAlive = false
+	}
+	return hasConnection
+}
+
+func isFramingHeader(key string) bool {
+	switch strings.ToLower(key) {
+	case "content-length", "transfer-encoding", "trailer":
+		return true
+	}
+	return false
 }
 
+// WriteBody writes p as the next part of the body. If the header section has
+// not been written yet, it is written first: the status line with the status
+// set by SetStatus, or 200, and the fields set through Header, completed with
+// a Content-Length of len(p) and a text/plain Content-Type. Writes past the
+// declared Content-Length fail with ErrContentLengthExceeded.
 func (w *Writer) WriteBody(p []byte) (int, error) {
-	if w.writerState == Body {
-		n, err := w.conn.Write(p)
-		if err != nil {
-			return 0, fmt.Errorf("failed to write body: %w", err)
+	for w.writerState != Body {
+		h := w.header.Clone()
+		_, hasLength := h.Get("Content-Length")
+		_, hasEncoding := h.Get("Transfer-Encoding")
+		if !hasLength && !hasEncoding {
+			h.Set("Content-Length", strconv.Itoa(len(p)))
+		}
+		if _, exists := h.Get("Content-Type"); !exists {
+			h.Set("Content-Type", "text/plain")
+		}
+		if err := w.WriteHeaders(h); err != nil {
+			return 0, err
 		}
-		return n, nil
 	}
-	return 0, fmt.Errorf("tried to write body while state was: %v", w.writerState)
+	if w.lastChunk || w.chunkedDone {
+		return 0, fmt.Errorf("tried to write body: %w", ErrBodyDone)
+	}
+	if w.noBody() {
+		w.bodyWritten += len(p)
+		return len(p), nil
+	}
+	if w.contentLength >= 0 && w.bodyWritten+len(p) > w.contentLength {
+		return 0, fmt.Errorf("%w: %d bytes written, %d more would exceed %d", ErrContentLengthExceeded, w.bodyWritten, len(p), w.contentLength)
+	}
+	n, err := w.buffered().Write(p)
+	w.bodyWritten += n
+	if err != nil {
+		return 0, fmt.Errorf("failed to write body: %w", err)
+	}
+	return n, nil
+}
+
+func (w *Writer) statusOrOK() StatusCode {
+	if w.status == 0 {
+		return StatusCodeOK
+	}
+	return w.status
 }
 
 func GetDefaultHeaders(contentLen int) headers.Headers {
 	h := headers.NewHeaders()
-	h["Content-Length"] = strconv.Itoa(contentLen)
-	h["Connection"] = "close"
-	h["Content-Type"] = "text/plain"
+	h.Set("Content-Length", strconv.Itoa(contentLen))
+	h.Set("Content-Type", "text/plain")
 	return h
 }
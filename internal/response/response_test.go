@@ -0,0 +1,697 @@
+package response
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeZeroSugar/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testDate is the Date sent by every response written in these tests.
+const testDate = "Sun, 06 Nov 1994 08:49:37 GMT"
+
+func init() {
+	now = func() time.Time {
+		return time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	}
+}
+
+// assertGolden compares got with testdata/<name>.golden, rewriting the file
+// instead when the tests run with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestWriterGolden(t *testing.T) {
+	// Test: Fixed length response on a persistent connection
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	body := []byte("Hello world!\n")
+	h := GetDefaultHeaders(len(body))
+	h.Add("Set-Cookie", "session=abc; Path=/")
+	h.Add("Set-Cookie", "theme=dark; Path=/")
+	h.Add("X-Request-Id", "42")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody(body)
+	require.NoError(t, err)
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assertGolden(t, "fixed_length", buf.Bytes())
+
+	// Test: Connection close response
+	buf.Reset()
+	w = NewWriter(&buf)
+	body = []byte("Bad Request\n")
+	require.NoError(t, w.WriteStatusLine(StatusCodeBadRequest))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(len(body))))
+	_, err = w.WriteBody(body)
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assertGolden(t, "close", buf.Bytes())
+
+	// Test: Chunked response with trailers, where empty chunks are skipped
+	// instead of ending the body early
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	h = headers.NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Content-Length")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	n, err := w.WriteChunkedBody(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	_, err = w.WriteChunkedBody([]byte("Hello "))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte{})
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("world!\n"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-Length", "13")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Nothing more can be written once the body has ended
+	_, err = w.WriteChunkedBody([]byte("more"))
+	assert.ErrorIs(t, err, ErrBodyDone)
+	_, err = w.WriteBody([]byte("more"))
+	assert.ErrorIs(t, err, ErrBodyDone)
+	_, err = w.WriteChunkedBodyDone()
+	assert.ErrorIs(t, err, ErrBodyDone)
+	assert.ErrorIs(t, w.WriteTrailers(trailers), ErrBodyDone)
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assertGolden(t, "chunked", buf.Bytes())
+
+	// Test: Field names are sent in canonical form
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	h = headers.NewHeaders()
+	h.Set("content-length", "0")
+	h.Set("x-CONTENT-sha256", "e3b0c442")
+	h.Set("WWW-Authenticate", "Basic")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assertGolden(t, "canonical_case", buf.Bytes())
+
+	// Test: Original casing is kept when asked to
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.SetPreserveHeaderCase(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assertGolden(t, "preserve_case", buf.Bytes())
+}
+
+func TestWriterRejectsInvalidFields(t *testing.T) {
+	// Test: CRLF in a header value is rejected before anything is written
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.Flush())
+	buf.Reset()
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/next\r\nSet-Cookie: session=stolen")
+	err := w.WriteHeaders(h)
+	assert.ErrorIs(t, err, headers.ErrInvalidFieldValue)
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+
+	// Test: NUL and a bare LF are rejected too
+	for _, value := range []string{"a\x00b", "a\nb", "a\rb"} {
+		h = GetDefaultHeaders(0)
+		h.Set("X-Echo", value)
+		assert.ErrorIs(t, w.WriteHeaders(h), headers.ErrInvalidFieldValue)
+	}
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+
+	// Test: Field names must be tokens
+	for _, name := range []string{"", "X Echo", "X-Echo:", "X-Echo\r\n"} {
+		h = GetDefaultHeaders(0)
+		h.Set(name, "value")
+		assert.ErrorIs(t, w.WriteHeaders(h), headers.ErrInvalidFieldName)
+	}
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+
+	// Test: The writer can still send valid headers afterwards
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "Content-Length: 0\r\n")
+
+	// Test: An implied status line is not written when a field is invalid
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("Location", "/next\r\nSet-Cookie: session=stolen")
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Finish(), headers.ErrInvalidFieldValue)
+	assert.Empty(t, buf.String())
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetServer("httpfromtcp\r\nX-Injected: yes")
+	assert.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(0)), headers.ErrInvalidFieldValue)
+	w.SetServer("httpfromtcp")
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, strings.Count(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, buf.String(), "X-Injected")
+
+	// Test: Trailers are validated the same way
+	buf.Reset()
+	w = NewWriter(&buf)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	written := buf.Len()
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc\r\n\r\nHTTP/1.1 200 OK")
+	assert.ErrorIs(t, w.WriteTrailers(trailers), headers.ErrInvalidFieldValue)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, written, buf.Len())
+}
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered codes use their reason phrase
+	for code, want := range map[StatusCode]string{
+		StatusCodeContinue:             "HTTP/1.1 100 Continue\r\n",
+		StatusCodeNoContent:            "HTTP/1.1 204 No Content\r\n",
+		StatusCodeNotFound:             "HTTP/1.1 404 Not Found\r\n",
+		StatusCodeTooManyRequests:      "HTTP/1.1 429 Too Many Requests\r\n",
+		StatusCodeServiceUnavailable:   "HTTP/1.1 503 Service Unavailable\r\n",
+		StatusCodeUnprocessableContent: "HTTP/1.1 422 Unprocessable Content\r\n",
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		require.NoError(t, w.WriteStatusLine(code))
+		require.NoError(t, w.Flush())
+		assert.Equal(t, want, buf.String())
+	}
+
+	// Test: Unregistered codes get an empty reason phrase
+	var buf bytes.Buffer
+	assert.Equal(t, "", StatusText(599))
+	assert.Equal(t, "", StatusText(418))
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(599))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 599 \r\n", buf.String())
+
+	// Test: Codes must be three digits
+	for _, code := range []StatusCode{0, 99, 1000, -200} {
+		buf.Reset()
+		w = NewWriter(&buf)
+		assert.Error(t, w.WriteStatusLine(code))
+		require.NoError(t, w.Flush())
+		assert.Empty(t, buf.String())
+		require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	}
+
+	// Test: Custom reason phrase for a proxied response
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLineReason(StatusCodeNotFound, "Nothing Here"))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.0 404 Nothing Here\r\n", buf.String())
+
+	// Test: Reason phrases cannot split the status line
+	buf.Reset()
+	w = NewWriter(&buf)
+	assert.Error(t, w.WriteStatusLineReason(StatusCodeOK, "OK\r\nSet-Cookie: a=b"))
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+}
+
+func TestAutoFraming(t *testing.T) {
+	// Test: A body that fits in the buffer is sent with a Content-Length
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Content-Type", "text/plain")
+	_, err := io.WriteString(w, "Hello ")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "world!\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assertGolden(t, "auto_content_length", buf.Bytes())
+
+	// Test: A body that outgrows the buffer is sent chunked and terminated
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.SetStatus(StatusCodeCreated)
+	w.Header().Set("Content-Type", "text/plain")
+	line := strings.Repeat("x", 1023) + "\n"
+	for range 5 {
+		_, err = io.WriteString(w, line)
+		require.NoError(t, err)
+	}
+	_, err = w.Write(nil)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 201 Created\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"1400\r\n"+strings.Repeat(line, 5)+"\r\n"+
+		"0\r\n"+
+		"\r\n", buf.String())
+
+	// Test: A Content-Length set by the handler is kept
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Content-Length", "5000")
+	_, err = w.Write(bytes.Repeat([]byte("y"), 5000))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\nDate: "+testDate+"\r\nContent-Length: 5000\r\n\r\nyyy"))
+	assert.NotContains(t, buf.String(), "Transfer-Encoding")
+
+	// Test: A small body is chunked if the handler asked for it
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"05\r\nhello\r\n"+
+		"0\r\n"+
+		"\r\n", buf.String())
+
+	// Test: A handler that writes nothing gets an empty 200
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nDate: "+testDate+"\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+	// Test: A handler that stops after the status line gets an empty body
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.Header().Set("X-Reason", "missing")
+	require.NoError(t, w.WriteStatusLine(StatusCodeNotFound))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nDate: "+testDate+"\r\n"+
+		"X-Reason: missing\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+	// Test: HTTP/1.0 bodies that outgrow the buffer are delimited by closing
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetVersion("1.0")
+	w.SetKeepAlive(true)
+	_, err = w.Write(bytes.Repeat([]byte("z"), autoBufferSize+1))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\nDate: "+testDate+"\r\n\r\n"+strings.Repeat("z", autoBufferSize+1), buf.String())
+
+	// Test: Responses written by hand are left alone
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err = w.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	written := buf.Len()
+	require.NoError(t, w.Finish())
+	assert.Equal(t, written, buf.Len())
+}
+
+func TestGeneratedHeaders(t *testing.T) {
+	// Test: WriteBody alone implies 200 OK and default headers
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetKeepAlive(true)
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello", buf.String())
+
+	// Test: Writes past the implied Content-Length are refused
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	_, err = w.WriteBody([]byte("a"))
+	require.NoError(t, err)
+	n, err := w.WriteBody([]byte("bc"))
+	assert.ErrorIs(t, err, ErrContentLengthExceeded)
+	assert.Equal(t, 0, n)
+	assert.True(t, w.KeepAlive())
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "Content-Length: 1\r\nContent-Type: text/plain\r\n\r\na"))
+
+	// Test: WriteHeaders alone implies the status line set by SetStatus
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetStatus(StatusCodeNotFound)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 404 Not Found\r\nConnection: close\r\n"))
+
+	// Test: Fields set through Header are used by an implied header section
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, w.WriteStatusLine(StatusCodeCreated))
+	_, err = w.WriteBody([]byte("{}"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "\r\nContent-Type: application/json\r\nContent-Length: 2\r\n")
+
+	// Test: Server is added when configured, handler fields take precedence
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetServer("httpfromtcp")
+	h := GetDefaultHeaders(0)
+	h.Set("Date", "Mon, 07 Nov 1994 00:00:00 GMT")
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, strings.Count(buf.String(), "Date:"))
+	assert.Contains(t, buf.String(), "\r\nDate: Mon, 07 Nov 1994 00:00:00 GMT\r\n")
+	assert.Contains(t, buf.String(), "\r\nServer: httpfromtcp\r\n")
+
+	// Test: An invalid Server value is refused like any other field
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	w.SetServer("httpfromtcp\r\nX-Injected: 1")
+	assert.ErrorIs(t, w.WriteHeaders(GetDefaultHeaders(0)), headers.ErrInvalidFieldValue)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", buf.String())
+}
+
+func TestHTTPDateCache(t *testing.T) {
+	first := time.Date(2024, time.February, 29, 23, 59, 59, 100, time.UTC)
+	assert.Equal(t, "Thu, 29 Feb 2024 23:59:59 GMT", httpDate(first))
+	assert.Equal(t, "Thu, 29 Feb 2024 23:59:59 GMT", httpDate(first.Add(800*time.Millisecond)))
+	assert.Equal(t, "Fri, 01 Mar 2024 00:00:00 GMT", httpDate(first.Add(time.Second)))
+	assert.Equal(t, "Fri, 01 Mar 2024 00:00:00 GMT", httpDate(first.Add(time.Second).In(time.FixedZone("CET", 3600))))
+	assert.Equal(t, testDate, httpDate(now()))
+}
+
+// countingWriter counts the writes that reach the connection.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func TestBufferedWrites(t *testing.T) {
+	// Test: Status line, header fields and a small body go out in one write
+	conn := &countingWriter{}
+	w := NewWriter(conn)
+	w.SetKeepAlive(true)
+	w.SetServer("httpfromtcp")
+	body := []byte("Hello world!\n")
+	h := GetDefaultHeaders(len(body))
+	for i := range 8 {
+		h.Add("X-Field", strconv.Itoa(i))
+	}
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody(body)
+	require.NoError(t, err)
+	assert.Equal(t, 0, conn.writes)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 1, conn.writes)
+	assert.True(t, strings.HasSuffix(conn.String(), "\r\n\r\nHello world!\n"))
+
+	// Test: Flush pushes streamed chunks out as they are written
+	conn = &countingWriter{}
+	w = NewWriter(conn)
+	w.SetKeepAlive(true)
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, conn.writes)
+	assert.True(t, strings.HasSuffix(conn.String(), "05\r\nfirst\r\n"))
+	_, err = w.WriteChunkedBody([]byte("second"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 2, conn.writes)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 3, conn.writes)
+	assert.True(t, strings.HasSuffix(conn.String(), "06\r\nsecond\r\n0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Flushing an unused writer writes nothing
+	conn = &countingWriter{}
+	require.NoError(t, NewWriter(conn).Flush())
+	assert.Equal(t, 0, conn.writes)
+
+	// Test: A response counts as sent only once it reaches the connection
+	conn = &countingWriter{}
+	w = NewWriter(conn)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	assert.False(t, w.Sent())
+	require.NoError(t, w.Flush())
+	assert.True(t, w.Sent())
+
+	// Test: Abort drops a response that was never sent
+	conn = &countingWriter{}
+	w = NewWriter(conn)
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	w.Abort()
+	require.NoError(t, w.Flush())
+	assert.False(t, w.Sent())
+	assert.Equal(t, 0, conn.writes)
+}
+
+func TestBodylessResponses(t *testing.T) {
+	// Test: HEAD responses carry the GET header fields but no body
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetMethod("HEAD")
+	w.SetKeepAlive(true)
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+
+	// Test: HEAD with automatic framing computes the Content-Length
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetMethod("HEAD")
+	w.SetKeepAlive(true)
+	_, err = io.WriteString(w, "Hello world!\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, strings.HasSuffix(buf.String(), "Content-Length: 13\r\n\r\n"))
+
+	// Test: HEAD with a body too large to buffer is announced as chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetMethod("HEAD")
+	w.SetKeepAlive(true)
+	_, err = w.Write(bytes.Repeat([]byte("x"), autoBufferSize+1))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, strings.HasSuffix(buf.String(), "Transfer-Encoding: chunked\r\n\r\n"))
+
+	// Test: HEAD with hand-written chunks and trailers sends only the header
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetMethod("HEAD")
+	w.SetKeepAlive(true)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusCodeOK))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("data"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.True(t, strings.HasSuffix(buf.String(), "Transfer-Encoding: chunked\r\n\r\n"))
+
+	// Test: 204 drops the body and the framing fields
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+
+	// Test: 304 keeps Content-Length but drops the body
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	w.SetStatus(StatusCodeNotModified)
+	w.Header().Set("Content-Length", "100")
+	_, err = io.WriteString(w, "ignored")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Length: 100\r\n"+
+		"\r\n", buf.String())
+
+	// Test: 1xx responses are interim and followed by the final response
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	require.NoError(t, w.WriteStatusLine(StatusCodeEarlyHints))
+	h = headers.NewHeaders()
+	h.Set("Link", "</style.css>; rel=preload")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.False(t, w.KeepAlive())
+	_, err = io.WriteString(w, "done")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 103 Early Hints\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Link: </style.css>; rel=preload\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Date: "+testDate+"\r\n"+
+		"Content-Length: 4\r\n"+
+		"\r\n"+
+		"done", buf.String())
+
+	// Test: 101 hands the connection over, so it is not kept alive for HTTP
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetKeepAlive(true)
+	h = headers.NewHeaders()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	require.NoError(t, w.WriteStatusLine(StatusCodeSwitchingProtocols))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestStatusAndBytesWritten(t *testing.T) {
+	// Test: Before anything is written the status is the one that will be sent
+	w := NewWriter(io.Discard)
+	assert.Equal(t, StatusCodeOK, w.Status())
+	w.SetStatus(StatusCodeNotFound)
+	assert.Equal(t, StatusCodeNotFound, w.Status())
+	assert.Equal(t, 0, w.BytesWritten())
+
+	// Test: Automatically framed bodies count while they are buffered
+	_, err := io.WriteString(w, "hello")
+	require.NoError(t, err)
+	assert.Equal(t, 5, w.BytesWritten())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, StatusCodeNotFound, w.Status())
+	assert.Equal(t, 5, w.BytesWritten())
+
+	// Test: An explicit status line wins over SetStatus
+	w = NewWriter(io.Discard)
+	w.SetStatus(StatusCodeNotFound)
+	require.NoError(t, w.WriteStatusLine(StatusCodeCreated))
+	assert.Equal(t, StatusCodeCreated, w.Status())
+
+	// Test: Chunk payloads count but their framing does not
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBody([]byte("defg"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 7, w.BytesWritten())
+
+	// Test: Discarded HEAD bodies still count
+	w = NewWriter(io.Discard)
+	w.SetMethod("HEAD")
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, w.BytesWritten())
+}
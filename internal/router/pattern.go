@@ -0,0 +1,162 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CodeZeroSugar/internal/request"
+)
+
+type segmentKind int
+
+// Segment kinds are ordered from most to least specific.
+const (
+	literalSegment  segmentKind = 0
+	paramSegment    segmentKind = 1
+	wildcardSegment segmentKind = 2
+)
+
+type segment struct {
+	kind segmentKind
+	// value is the literal text, or the parameter name.
+	value string
+}
+
+// pattern is a parsed route path such as "/users/{id}" or "/static/{path...}".
+type pattern struct {
+	raw      string
+	segments []segment
+}
+
+func parsePattern(raw string) (pattern, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return pattern{}, fmt.Errorf("pattern '%s' must start with '/'", raw)
+	}
+	p := pattern{raw: raw}
+	names := make(map[string]bool)
+	parts := strings.Split(raw[1:], "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return pattern{}, fmt.Errorf("pattern '%s': segment '%s' must be a literal or a whole {name}", raw, part)
+			}
+			p.segments = append(p.segments, segment{kind: literalSegment, value: part})
+			continue
+		}
+		name := part[1 : len(part)-1]
+		kind := paramSegment
+		if trimmed, found := strings.CutSuffix(name, "..."); found {
+			if i != len(parts)-1 {
+				return pattern{}, fmt.Errorf("pattern '%s': wildcard {%s} must be the last segment", raw, name)
+			}
+			name = trimmed
+			kind = wildcardSegment
+		}
+		if !validName(name) {
+			return pattern{}, fmt.Errorf("pattern '%s': invalid parameter name '%s'", raw, name)
+		}
+		if names[name] {
+			return pattern{}, fmt.Errorf("pattern '%s': duplicate parameter name '%s'", raw, name)
+		}
+		names[name] = true
+		p.segments = append(p.segments, segment{kind: kind, value: name})
+	}
+	return p, nil
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		if !isLetter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether rawPath, the path as sent by the client, matches p,
+// and returns the values of its parameters. rawPath must start with '/'. It is
+// split into segments before they are decoded, so an encoded '/' cannot add a
+// segment. Paths with a "." or ".." segment, once decoded, match nothing.
+func (p pattern) match(rawPath string) (map[string]string, bool) {
+	var values map[string]string
+	rest := rawPath[1:]
+	for i, seg := range p.segments {
+		if seg.kind == wildcardSegment {
+			value, err := request.UnescapePath(rest)
+			if err != nil || hasDotSegment(value) {
+				return nil, false
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[seg.value] = value
+			return values, true
+		}
+		rawPart, next, found := strings.Cut(rest, "/")
+		if found != (i < len(p.segments)-1) {
+			return nil, false
+		}
+		part, err := request.UnescapePath(rawPart)
+		if err != nil || hasDotSegment(part) {
+			return nil, false
+		}
+		switch seg.kind {
+		case literalSegment:
+			if part != seg.value {
+				return nil, false
+			}
+		case paramSegment:
+			if part == "" {
+				return nil, false
+			}
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[seg.value] = part
+		}
+		rest = next
+	}
+	return values, true
+}
+
+// hasDotSegment reports whether the decoded path part contains a "." or ".."
+// segment, which a handler could use to escape the directory it serves.
+func hasDotSegment(part string) bool {
+	for _, seg := range strings.Split(part, "/") {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// moreSpecific reports whether p takes precedence over q when both match the
+// same path: at the first segment where they differ in kind, a literal beats a
+// parameter, and a parameter beats a wildcard.
+func (p pattern) moreSpecific(q pattern) bool {
+	for i := 0; i < len(p.segments) && i < len(q.segments); i++ {
+		if p.segments[i].kind != q.segments[i].kind {
+			return p.segments[i].kind < q.segments[i].kind
+		}
+	}
+	return len(p.segments) > len(q.segments)
+}
+
+// sameShape reports whether p and q match exactly the same paths.
+func (p pattern) sameShape(q pattern) bool {
+	if len(p.segments) != len(q.segments) {
+		return false
+	}
+	for i, seg := range p.segments {
+		other := q.segments[i]
+		if seg.kind != other.kind || (seg.kind == literalSegment && seg.value != other.value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+// Package router dispatches requests to server handlers by method and path.
+package router
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/CodeZeroSugar/internal/request"
+	"github.com/CodeZeroSugar/internal/response"
+	"github.com/CodeZeroSugar/internal/server"
+)
+
+type route struct {
+	method  string
+	pattern pattern
+	handler server.Handler
+}
+
+// Router matches requests against registered routes. A pattern is a path
+// whose segments are literals, parameters such as {id} that match one
+// non-empty segment, or a final wildcard such as {path...} that matches the
+// rest of the path. Paths are split into segments before they are decoded,
+// so "%2F" never separates segments. Parameter values are available, decoded,
+// through request.Request.PathValue. Paths with a "." or ".." segment, plain or
+// encoded as in "%2e%2e", are rejected rather than cleaned: they match no
+// pattern, so a parameter or wildcard value never contains one.
+//
+// When several patterns match a path, the most specific wins: comparing
+// segments from the left, a literal beats a parameter and a parameter beats a
+// wildcard. Routes registered for a method beat routes registered for any
+// method. GET routes also answer HEAD.
+//
+// Paths that match no pattern are answered with 404. Paths that match only
+// routes for other methods are answered with 405 and an Allow field. OPTIONS
+// requests without a route of their own are answered with 204 and the Allow
+// field of the path, or of the whole server for "OPTIONS *".
+type Router struct {
+	routes     []route
+	notFound   server.Handler
+	middleware []server.Middleware
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for requests with the given method and a path
+// matching pattern. An empty method matches every method. The middlewares
+// wrap handler for this route only, inside the ones added with Use. Handle
+// panics if the pattern is invalid or already registered for the method.
+func (r *Router) Handle(method, rawPattern string, handler server.Handler, middlewares ...server.Middleware) {
+	p, err := parsePattern(rawPattern)
+	if err != nil {
+		panic(fmt.Sprintf("router: %s", err))
+	}
+	for _, existing := range r.routes {
+		if existing.method == method && existing.pattern.sameShape(p) {
+			panic(fmt.Sprintf("router: pattern '%s' conflicts with '%s' for method '%s'", rawPattern, existing.pattern.raw, method))
+		}
+	}
+	handler = server.Chain(middlewares...)(handler)
+	r.routes = append(r.routes, route{method: method, pattern: p, handler: handler})
+}
+
+// Use adds middlewares that wrap every request the router answers, including
+// the 404, 405 and OPTIONS responses it writes itself. It must be called
+// before Handler.
+func (r *Router) Use(middlewares ...server.Middleware) {
+	r.middleware = append(r.middleware, middlewares...)
+}
+
+// SetNotFound replaces the handler for paths that match no route.
+func (r *Router) SetNotFound(handler server.Handler) {
+	r.notFound = handler
+}
+
+// Handler returns the server.Handler that dispatches requests to the routes.
+func (r *Router) Handler() server.Handler {
+	return server.Chain(r.middleware...)(r.serve)
+}
+
+func (r *Router) serve(w *response.Writer, req *request.Request) {
+	method := req.RequestLine.Method
+	if req.Target.Form == request.AsteriskForm {
+		writeAllow(w, response.StatusCodeNoContent, allowed(r.routes))
+		return
+	}
+	path := req.Target.RawPath
+	if path == "" {
+		path = "/"
+	}
+
+	var matched []route
+	var best *route
+	var bestValues map[string]string
+	for i := range r.routes {
+		rt := &r.routes[i]
+		values, ok := rt.pattern.match(path)
+		if !ok {
+			continue
+		}
+		matched = append(matched, *rt)
+		if !methodMatches(rt.method, method) {
+			continue
+		}
+		if best == nil || rt.beats(best, method) {
+			best, bestValues = rt, values
+		}
+	}
+
+	switch {
+	case best != nil:
+		for name, value := range bestValues {
+			req.SetPathValue(name, value)
+		}
+		best.handler(w, req)
+	case len(matched) == 0:
+		if r.notFound != nil {
+			r.notFound(w, req)
+			return
+		}
+		writeStatus(w, response.StatusCodeNotFound)
+	case method == "OPTIONS":
+		writeAllow(w, response.StatusCodeNoContent, allowed(matched))
+	default:
+		writeAllow(w, response.StatusCodeMethodNotAllowed, allowed(matched))
+	}
+}
+
+func methodMatches(routeMethod, method string) bool {
+	return routeMethod == "" || routeMethod == method || (routeMethod == "GET" && method == "HEAD")
+}
+
+// beats reports whether rt takes precedence over other for a request with the
+// given method.
+func (rt *route) beats(other *route, method string) bool {
+	if rt.pattern.moreSpecific(other.pattern) {
+		return true
+	}
+	if other.pattern.moreSpecific(rt.pattern) {
+		return false
+	}
+	return methodRank(rt.method, method) < methodRank(other.method, method)
+}
+
+// methodRank orders the ways a route method can match: exactly, as GET for a
+// HEAD request, or as any method.
+func methodRank(routeMethod, method string) int {
+	switch routeMethod {
+	case method:
+		return 0
+	case "":
+		return 2
+	}
+	return 1
+}
+
+// allowed returns the Allow field value for routes, or "" if one of them
+// accepts any method.
+func allowed(routes []route) string {
+	methods := []string{"OPTIONS"}
+	for _, rt := range routes {
+		if rt.method == "" {
+			return ""
+		}
+		methods = append(methods, rt.method)
+		if rt.method == "GET" {
+			methods = append(methods, "HEAD")
+		}
+	}
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
+
+func writeAllow(w *response.Writer, statusCode response.StatusCode, allow string) {
+	if allow != "" {
+		w.Header().Set("Allow", allow)
+	}
+	writeStatus(w, statusCode)
+}
+
+// writeStatus answers with the reason phrase of statusCode as a plain text
+// body, like server.DefaultErrorHandler.
+func writeStatus(w *response.Writer, statusCode response.StatusCode) {
+	w.SetStatus(statusCode)
+	if statusCode == response.StatusCodeNoContent {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := io.WriteString(w, response.StatusText(statusCode)+"\n"); err != nil {
+		log.Printf("router failed to write %d response: %s", statusCode, err)
+	}
+}
@@ -0,0 +1,223 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/CodeZeroSugar/internal/request"
+	"github.com/CodeZeroSugar/internal/response"
+	"github.com/CodeZeroSugar/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var dateLine = regexp.MustCompile(`Date: [^\r]*\r\n`)
+
+// serve answers a request with the given request line with r and returns the
+// response, without its Date field.
+func serve(t *testing.T, r *Router, requestLine string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(requestLine + "\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetMethod(req.RequestLine.Method)
+	w.SetKeepAlive(true)
+	r.Handler()(w, req)
+	require.NoError(t, w.Finish())
+	return dateLine.ReplaceAllString(buf.String(), "")
+}
+
+// reply returns a handler that answers with name and the given path values.
+func reply(name string, params ...string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		body := name
+		for _, param := range params {
+			body += " " + param + "=" + req.PathValue(param)
+		}
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func body(out string) string {
+	_, b, _ := strings.Cut(out, "\r\n\r\n")
+	return b
+}
+
+func TestRouter(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/", reply("root"))
+	r.Handle("GET", "/users", reply("list"))
+	r.Handle("POST", "/users", reply("create"))
+	r.Handle("GET", "/users/me", reply("me"))
+	r.Handle("GET", "/users/{id}", reply("user", "id"))
+	r.Handle("DELETE", "/users/{id}", reply("delete", "id"))
+	r.Handle("GET", "/users/{id}/posts/{post}", reply("post", "id", "post"))
+	r.Handle("GET", "/static/{path...}", reply("static", "path"))
+	r.Handle("GET", "/static/favicon.ico", reply("favicon"))
+	r.Handle("", "/any", reply("any"))
+	r.Handle("PUT", "/any", reply("put"))
+
+	// Test: Literal routes
+	assert.Equal(t, "root", body(serve(t, r, "GET / HTTP/1.1")))
+	assert.Equal(t, "list", body(serve(t, r, "GET /users HTTP/1.1")))
+	assert.Equal(t, "create", body(serve(t, r, "POST /users HTTP/1.1")))
+
+	// Test: Named parameters match one segment
+	assert.Equal(t, "user id=42", body(serve(t, r, "GET /users/42 HTTP/1.1")))
+	assert.Equal(t, "delete id=42", body(serve(t, r, "DELETE /users/42 HTTP/1.1")))
+	assert.Equal(t, "post id=7 post=hello", body(serve(t, r, "GET /users/7/posts/hello HTTP/1.1")))
+	assert.Equal(t, "user id=a b", body(serve(t, r, "GET /users/a%20b HTTP/1.1")))
+
+	// Test: An encoded '/' stays inside its segment
+	assert.Equal(t, "user id=a/posts/b", body(serve(t, r, "GET /users/a%2Fposts%2Fb HTTP/1.1")))
+	assert.Equal(t, "post id=a/b post=c", body(serve(t, r, "GET /users/a%2Fb/posts/c HTTP/1.1")))
+	assert.Contains(t, serve(t, r, "GET /users%2Fme HTTP/1.1"), "HTTP/1.1 404 Not Found\r\n")
+	assert.Equal(t, "me", body(serve(t, r, "GET /users/%6De HTTP/1.1")))
+
+	// Test: Wildcards match the rest of the path
+	assert.Equal(t, "static path=css/site.css", body(serve(t, r, "GET /static/css/site.css HTTP/1.1")))
+	assert.Equal(t, "static path=", body(serve(t, r, "GET /static/ HTTP/1.1")))
+	assert.Equal(t, "static path=a b/c", body(serve(t, r, "GET /static/a%20b%2Fc HTTP/1.1")))
+
+	// Test: Paths with dot segments match no pattern, even encoded
+	for _, requestLine := range []string{
+		"GET /static/../secret HTTP/1.1",
+		"GET /static/css/./site.css HTTP/1.1",
+		"GET /static/%2e%2e/secret HTTP/1.1",
+		"GET /static/a%2F..%2Fsecret HTTP/1.1",
+		"GET /users/.. HTTP/1.1",
+		"GET /users/..%2F..%2Fetc HTTP/1.1",
+	} {
+		assert.Contains(t, serve(t, r, requestLine), "HTTP/1.1 404 Not Found\r\n", requestLine)
+	}
+	assert.Equal(t, "static path=a..b/.c", body(serve(t, r, "GET /static/a..b/.c HTTP/1.1")))
+
+	// Test: Literals take precedence over parameters and wildcards
+	assert.Equal(t, "me", body(serve(t, r, "GET /users/me HTTP/1.1")))
+	assert.Equal(t, "favicon", body(serve(t, r, "GET /static/favicon.ico HTTP/1.1")))
+
+	// Test: Routes for a method take precedence over routes for any method
+	assert.Equal(t, "put", body(serve(t, r, "PUT /any HTTP/1.1")))
+	assert.Equal(t, "any", body(serve(t, r, "PATCH /any HTTP/1.1")))
+
+	// Test: GET routes answer HEAD without a body
+	out := serve(t, r, "HEAD /users/42 HTTP/1.1")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n", out)
+
+	// Test: Unknown paths are answered with 404
+	for _, requestLine := range []string{
+		"GET /missing HTTP/1.1",
+		"GET /users/ HTTP/1.1",
+		"GET /users/42/ HTTP/1.1",
+		"GET /static HTTP/1.1",
+		"POST /users/7/posts HTTP/1.1",
+	} {
+		out = serve(t, r, requestLine)
+		assert.Equal(t, "HTTP/1.1 404 Not Found\r\n"+
+			"Content-Type: text/plain\r\n"+
+			"Content-Length: 10\r\n"+
+			"\r\n"+
+			"Not Found\n", out, requestLine)
+	}
+
+	// Test: Known paths with another method are answered with 405 and Allow
+	out = serve(t, r, "PATCH /users/42 HTTP/1.1")
+	assert.Equal(t, "HTTP/1.1 405 Method Not Allowed\r\n"+
+		"Allow: DELETE, GET, HEAD, OPTIONS\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 19\r\n"+
+		"\r\n"+
+		"Method Not Allowed\n", out)
+	out = serve(t, r, "DELETE /users HTTP/1.1")
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: OPTIONS is answered automatically
+	out = serve(t, r, "OPTIONS /static/favicon.ico HTTP/1.1")
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Allow: GET, HEAD, OPTIONS\r\n"+
+		"\r\n", out)
+	out = serve(t, r, "OPTIONS * HTTP/1.1")
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", out)
+	assert.Contains(t, serve(t, r, "OPTIONS /missing HTTP/1.1"), "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Server-wide OPTIONS lists every method when no route accepts any
+	r2 := New()
+	r2.Handle("GET", "/", reply("root"))
+	r2.Handle("POST", "/form", reply("form"))
+	out = serve(t, r2, "OPTIONS * HTTP/1.1")
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Allow: GET, HEAD, OPTIONS, POST\r\n"+
+		"\r\n", out)
+
+	// Test: Explicit OPTIONS routes replace the automatic answer
+	r2.Handle("OPTIONS", "/form", reply("options"))
+	assert.Equal(t, "options", body(serve(t, r2, "OPTIONS /form HTTP/1.1")))
+
+	// Test: The 404 handler can be replaced
+	r2.SetNotFound(func(w *response.Writer, req *request.Request) {
+		w.SetStatus(response.StatusCodeNotFound)
+		_, _ = w.Write([]byte("nothing at " + req.Target.Path))
+	})
+	assert.Equal(t, "nothing at /missing", body(serve(t, r2, "GET /missing HTTP/1.1")))
+}
+
+func TestRouterPatterns(t *testing.T) {
+	// Test: Invalid patterns panic at registration
+	for _, pattern := range []string{
+		"",
+		"users",
+		"/users/{}",
+		"/users/{id",
+		"/users/x{id}",
+		"/users/{1d}",
+		"/users/{user-id}",
+		"/{path...}/edit",
+		"/{id}/{id}",
+	} {
+		assert.Panics(t, func() { New().Handle("GET", pattern, reply("x")) }, pattern)
+	}
+
+	// Test: Patterns that match the same paths conflict for the same method
+	r := New()
+	r.Handle("GET", "/users/{id}", reply("user"))
+	assert.Panics(t, func() { r.Handle("GET", "/users/{name}", reply("user")) })
+	assert.NotPanics(t, func() { r.Handle("POST", "/users/{name}", reply("user")) })
+	assert.NotPanics(t, func() { r.Handle("GET", "/users/{id}/", reply("user")) })
+	assert.NotPanics(t, func() { r.Handle("GET", "/users/{id...}", reply("user")) })
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name)
+				next(w, req)
+				calls = append(calls, fmt.Sprintf("%s %d %d", name, w.Status(), w.BytesWritten()))
+			}
+		}
+	}
+	r := New()
+	r.Use(trace("global"))
+	r.Handle("GET", "/admin", reply("admin"), trace("auth"), trace("audit"))
+	r.Handle("GET", "/public", reply("public"))
+
+	// Test: Route middleware runs inside global middleware, in order
+	assert.Equal(t, "admin", body(serve(t, r, "GET /admin HTTP/1.1")))
+	assert.Equal(t, []string{"global", "auth", "audit", "audit 200 5", "auth 200 5", "global 200 5"}, calls)
+
+	// Test: Route middleware only wraps its own route
+	calls = nil
+	assert.Equal(t, "public", body(serve(t, r, "GET /public HTTP/1.1")))
+	assert.Equal(t, []string{"global", "global 200 6"}, calls)
+
+	// Test: Global middleware wraps the responses the router writes itself
+	calls = nil
+	serve(t, r, "GET /missing HTTP/1.1")
+	serve(t, r, "POST /admin HTTP/1.1")
+	assert.Equal(t, []string{"global", "global 404 10", "global", "global 405 19"}, calls)
+}
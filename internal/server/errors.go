@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+
+	"github.com/CodeZeroSugar/internal/request"
+	"github.com/CodeZeroSugar/internal/response"
+)
+
+// ErrHandlerPanic is passed to the ErrorHandler, wrapped with the panic value,
+// when a handler panics before any of its response was sent.
+var ErrHandlerPanic = errors.New("handler panicked")
+
+// callHandler runs the handler and recovers a panic in it, which would
+// otherwise crash the whole server. The panic is logged with its stack trace
+// and returned as an error wrapping ErrHandlerPanic.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, v, debug.Stack())
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, v)
+		}
+	}()
+	s.handler(w, req)
+	return nil
+}
+
+// handleError answers with the response written by the ErrorHandler. A panic
+// in the ErrorHandler is logged and recovered, and drops the response, since
+// the connection is closed afterwards anyway.
+func (s *Server) handleError(w *response.Writer, err error) {
+	errorHandler := s.errorHandler
+	if errorHandler == nil {
+		errorHandler = DefaultErrorHandler
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("panic in error handler answering %q: %v\n%s", err, v, debug.Stack())
+			w.Abort()
+		}
+	}()
+	statusCode := statusForError(err)
+	w.SetStatus(statusCode)
+	errorHandler(w, statusCode, err)
+	if err := w.Finish(); err != nil {
+		log.Printf("failed to finish error response: %s", err)
+	}
+}
+
+// statusForError picks the status code used to answer a request that could
+// not be read or whose handler panicked.
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, ErrHandlerPanic):
+		return response.StatusCodeInternalServerError
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return response.StatusCodeRequestTimeout
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusCodeURITooLong
+	case errors.Is(err, request.ErrHeaderFieldsTooLarge):
+		return response.StatusCodeRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusCodeContentTooLarge
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return response.StatusCodeNotImplemented
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusCodeHTTPVersionNotSupported
+	default:
+		return response.StatusCodeBadRequest
+	}
+}
+
+// ErrorHandler writes the response for a request that could not be read, or
+// whose handler panicked before any of its response was sent, in which case
+// err wraps ErrHandlerPanic and statusCode is 500. It also replaces an unsent
+// handler response when the request body turned out to be too large. The server picks statusCode
+// from err before calling it, and closes the connection afterwards. statusCode
+// is already set on w, so a handler that writes nothing sends an empty
+// response with that status.
+type ErrorHandler func(w *response.Writer, statusCode response.StatusCode, err error)
+
+// DefaultErrorHandler answers with the reason phrase of statusCode as a plain
+// text body.
+func DefaultErrorHandler(w *response.Writer, statusCode response.StatusCode, err error) {
+	body := []byte(response.StatusText(statusCode) + "\n")
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		log.Printf("failed to write status line for error response: %s", err)
+		return
+	}
+	if err := w.WriteHeaders(response.GetDefaultHeaders(len(body))); err != nil {
+		log.Printf("failed to write headers for error response: %s", err)
+		return
+	}
+	if _, err := w.WriteBody(body); err != nil {
+		log.Printf("failed to write body for error response: %s", err)
+	}
+}
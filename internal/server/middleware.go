@@ -0,0 +1,19 @@
+package server
+
+// Middleware wraps a Handler to run code before or after it, such as logging,
+// authentication or recovery. After the wrapped handler returns, a middleware
+// can inspect what it wrote through response.Writer.Status and
+// response.Writer.BytesWritten.
+type Middleware func(Handler) Handler
+
+// Chain composes middlewares into one. The first middleware is the outermost,
+// so it runs first and sees the request before, and the response after, all
+// the others.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
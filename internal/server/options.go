@@ -0,0 +1,38 @@
+package server
+
+import "github.com/CodeZeroSugar/internal/request"
+
+// Option configures a Server created by Serve.
+type Option func(*Server)
+
+// WithLimits sets the parser limits applied to every request. Requests that
+// exceed them are answered with 414, 431 or 413.
+func WithLimits(limits request.Limits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithTimeouts sets the read, write and idle timeouts applied to every
+// connection. None are applied by default.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// WithErrorHandler replaces DefaultErrorHandler for requests that could not
+// be read and for handlers that panicked.
+func WithErrorHandler(errorHandler ErrorHandler) Option {
+	return func(s *Server) {
+		s.errorHandler = errorHandler
+	}
+}
+
+// WithServerHeader sets the Server field added to every response. None is
+// sent by default.
+func WithServerHeader(server string) Option {
+	return func(s *Server) {
+		s.serverHeader = server
+	}
+}
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/CodeZeroSugar/internal/request"
 	"github.com/CodeZeroSugar/internal/response"
@@ -16,11 +20,21 @@ type Server struct {
 	closed   atomic.Bool
 	listener net.Listener
 	handler  Handler
+	limits   request.Limits
+	timeouts Timeouts
+
+	errorHandler ErrorHandler
+	serverHeader string
+
+	shuttingDown atomic.Bool
+	mu           sync.Mutex
+	conns        map[net.Conn]connState
+	onShutdown   []func()
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
-func Serve(port int, handler Handler) (*Server, error) {
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
 	address := ":" + strconv.Itoa(port)
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
@@ -30,6 +44,10 @@ func Serve(port int, handler Handler) (*Server, error) {
 	server := &Server{
 		listener: listener,
 		handler:  handler,
+		limits:   request.DefaultLimits,
+	}
+	for _, opt := range opts {
+		opt(server)
 	}
 
 	go server.listen()
@@ -60,17 +78,89 @@ func (s *Server) listen() {
 			continue
 		}
 
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
-	req, err := request.RequestFromReader(conn)
-	w := response.NewWriter(conn)
-	if err != nil {
-		s.handler(w, req)
-		return
+	defer s.forgetConn(conn)
+	reader := request.NewReader(conn)
+	reader.Limits = s.limits
+	start := time.Now()
+	conn.SetReadDeadline(deadline(start, s.timeouts.readHeader()))
+	for first := true; ; first = false {
+		if !first {
+			s.setConnState(conn, stateIdle)
+			conn.SetReadDeadline(deadline(time.Now(), s.timeouts.idle()))
+		}
+		if err := reader.Wait(); err != nil {
+			// Connections that close or time out between requests, or whose
+			// previous request body cannot be discarded, are closed without a
+			// response, since there is no request to answer.
+			return
+		}
+		s.setConnState(conn, stateActive)
+		if !first {
+			start = time.Now()
+			conn.SetReadDeadline(deadline(start, s.timeouts.readHeader()))
+		}
+		req, err := reader.ReadRequest()
+		if err != nil {
+			// io.EOF means the client closed the connection after sending only
+			// empty lines, which is no request either.
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			var netErr net.Error
+			if !errors.As(err, &netErr) || netErr.Timeout() {
+				conn.SetWriteDeadline(deadline(time.Now(), s.timeouts.WriteTimeout))
+				s.handleError(s.newWriter(conn), err)
+			}
+			return
+		}
+		conn.SetReadDeadline(deadline(start, s.timeouts.ReadTimeout))
+		conn.SetWriteDeadline(deadline(time.Now(), s.timeouts.WriteTimeout))
+
+		w := s.newWriter(conn)
+		w.SetVersion(req.RequestLine.HttpVersion)
+		w.SetMethod(req.RequestLine.Method)
+		w.SetKeepAlive(req.KeepAlive() && !s.shuttingDown.Load())
+		err = s.callHandler(w, req)
+		if err == nil && !w.Sent() && errors.Is(req.BodyError(), request.ErrBodyTooLarge) {
+			// A chunked body only turns out to be too large while the handler
+			// reads it, so answer with 413 as for a Content-Length that is.
+			err = req.BodyError()
+		}
+		if err != nil {
+			// Once part of the response has been sent, the client can only
+			// learn that it is incomplete from the connection closing early.
+			sent := w.Sent()
+			w.Abort()
+			if !sent {
+				w = s.newWriter(conn)
+				w.SetVersion(req.RequestLine.HttpVersion)
+				w.SetMethod(req.RequestLine.Method)
+				s.handleError(w, err)
+			}
+			return
+		}
+		if err := w.Finish(); err != nil {
+			log.Printf("failed to finish response: %s", err)
+			return
+		}
+		if !w.KeepAlive() || s.shuttingDown.Load() {
+			return
+		}
 	}
-	s.handler(w, req)
+}
+
+func (s *Server) newWriter(conn net.Conn) *response.Writer {
+	w := response.NewWriter(conn)
+	w.SetServer(s.serverHeader)
+	return w
 }
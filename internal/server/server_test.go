@@ -0,0 +1,662 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeZeroSugar/internal/headers"
+	"github.com/CodeZeroSugar/internal/request"
+	"github.com/CodeZeroSugar/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func targetHandler(w *response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	_ = w.WriteStatusLine(response.StatusCodeOK)
+	_ = w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	_, _ = w.WriteBody(body)
+}
+
+// exchange writes raw to a connection served by s and returns everything the
+// server sends back before it closes the connection.
+func exchange(t *testing.T, s *Server, raw string) string {
+	t.Helper()
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn)
+		close(done)
+	}()
+	go func() {
+		_, _ = client.Write([]byte(raw))
+	}()
+	out, err := io.ReadAll(client)
+	require.NoError(t, err)
+	<-done
+	return string(out)
+}
+
+// readResponse reads one response with a Content-Length from r.
+func readResponse(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var out strings.Builder
+	contentLength := 0
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		out.WriteString(line)
+		if value, found := strings.CutPrefix(line, "Content-Length: "); found {
+			contentLength, err = strconv.Atoi(strings.TrimSpace(value))
+			require.NoError(t, err)
+		}
+		if line == "\r\n" {
+			break
+		}
+	}
+	body := make([]byte, contentLength)
+	_, err := io.ReadFull(r, body)
+	require.NoError(t, err)
+	out.Write(body)
+	return out.String()
+}
+
+var dateLine = regexp.MustCompile(`Date: [^\r]*\r\n`)
+
+// withoutDate removes the Date fields from out, which change every second.
+func withoutDate(out string) string {
+	return dateLine.ReplaceAllString(out, "")
+}
+
+func TestPersistentConnections(t *testing.T) {
+	// Test: Pipelined requests are answered in order on one connection
+	s := &Server{handler: targetHandler}
+	out := exchange(t, s, "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"+
+		"POST /two HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello"+
+		"GET /three HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 3, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Equal(t, 1, strings.Count(out, "Connection: close\r\n"))
+	one := strings.Index(out, "\r\n\r\n/one")
+	two := strings.Index(out, "\r\n\r\n/two")
+	three := strings.Index(out, "\r\n\r\n/three")
+	require.NotEqual(t, -1, one)
+	assert.Less(t, one, two)
+	assert.Less(t, two, three)
+	assert.True(t, strings.HasSuffix(out, "/three"))
+
+	// Test: Unread request bodies are skipped before the next request
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"5\r\nhello\r\n0\r\n\r\n"+
+		"GET /after HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 2, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "/after"))
+
+	// Test: An empty line after a request body is ignored
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "POST /a HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello\r\n"+
+		"GET /b HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 2, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(out, "/b"))
+
+	// Test: A malformed unread body closes the connection without a second response
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "POST /a HTTP/1.1\r\nHost: localhost:42069\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"zz\r\nhello\r\n0\r\n\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n/a"))
+
+	// Test: Responses without a Content-Length close the connection
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		_ = w.WriteStatusLine(response.StatusCodeOK)
+		_ = w.WriteHeaders(h)
+		_, _ = w.WriteBody([]byte("streamed"))
+	}}
+	out = exchange(t, s, "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Connection: close\r\n")
+
+	// Test: HEAD responses have no body and keep the connection open
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "HEAD /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 4\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: 4\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"/two", withoutDate(out))
+}
+
+func TestBadRequests(t *testing.T) {
+	// Test: Malformed percent-escape is answered with 400
+	called := false
+	s := &Server{handler: func(w *response.Writer, req *request.Request) {
+		called = true
+	}}
+	out := exchange(t, s, "GET /bad%zz HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.False(t, called)
+}
+
+func TestHTTP10(t *testing.T) {
+	// Test: HTTP/1.0 responses use HTTP/1.0 and close the connection
+	s := &Server{handler: targetHandler}
+	out := exchange(t, s, "GET /one HTTP/1.0\r\nHost: localhost:42069\r\n\r\n"+
+		"GET /two HTTP/1.0\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.0 200 OK\r\n"))
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n/one"))
+
+	// Test: HTTP/1.0 keep-alive
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "GET /one HTTP/1.0\r\nHost: localhost:42069\r\nConnection: keep-alive\r\n\r\n"+
+		"GET /two HTTP/1.0\r\nHost: localhost:42069\r\n\r\n")
+	assert.Equal(t, 2, strings.Count(out, "HTTP/1.0 200 OK\r\n"))
+	assert.Equal(t, 1, strings.Count(out, "Connection: keep-alive\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n/two"))
+
+	// Test: Chunked responses fall back to a close-delimited body
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(0)
+		h.Del("Content-Length")
+		h.Set("Transfer-Encoding", "chunked")
+		h.Set("Trailer", "X-Count")
+		_ = w.WriteStatusLine(response.StatusCodeOK)
+		_ = w.WriteHeaders(h)
+		_, _ = w.WriteChunkedBody([]byte("hello "))
+		_, _ = w.WriteChunkedBody([]byte("world"))
+		_, _ = w.WriteChunkedBodyDone()
+		trailers := headers.NewHeaders()
+		trailers.Set("X-Count", "2")
+		_ = w.WriteTrailers(trailers)
+	}}
+	out = exchange(t, s, "GET / HTTP/1.0\r\nHost: localhost:42069\r\nConnection: keep-alive\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.0 200 OK\r\n"))
+	assert.NotContains(t, out, "Transfer-Encoding")
+	assert.NotContains(t, out, "Trailer")
+	assert.NotContains(t, out, "X-Count")
+	assert.Contains(t, out, "Connection: close\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nhello world"))
+
+	// Test: Unsupported version is answered with 505
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 505 HTTP Version Not Supported\r\n"))
+
+	// Test: Malformed version is answered with 400
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "GET / HTTP\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+}
+
+func TestLimitResponses(t *testing.T) {
+	limits := request.Limits{
+		MaxRequestLineLength: 32,
+		MaxHeaderBytes:       64,
+		MaxHeaderCount:       3,
+		MaxBodySize:          10,
+	}
+
+	// Test: Request line too long is answered with 414
+	s := &Server{handler: targetHandler, limits: limits}
+	out := exchange(t, s, "GET /"+strings.Repeat("a", 64)+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 414 URI Too Long\r\n"))
+
+	// Test: Too many headers is answered with 431
+	s = &Server{handler: targetHandler, limits: limits}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 431 Request Header Fields Too Large\r\n"))
+
+	// Test: Body too large is answered with 413
+	s = &Server{handler: targetHandler, limits: limits}
+	out = exchange(t, s, "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello world")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\n"))
+
+	// Test: A chunked body found too large by the handler is answered with 413
+	s = &Server{limits: limits, handler: func(w *response.Writer, req *request.Request) {
+		if _, err := req.BodyBytes(); err != nil {
+			w.SetStatus(response.StatusCodeBadRequest)
+		}
+	}}
+	out = exchange(t, s, "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"6\r\nhello \r\n5\r\nworld\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 413 Content Too Large\r\nConnection: close\r\n"))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+}
+
+func TestErrorHandler(t *testing.T) {
+	// Test: Custom error handler receives the status and the parse error
+	var gotStatus response.StatusCode
+	var gotErr error
+	s := &Server{
+		handler: targetHandler,
+		errorHandler: func(w *response.Writer, statusCode response.StatusCode, err error) {
+			gotStatus = statusCode
+			gotErr = err
+			body := []byte("<h1>custom</h1>")
+			_ = w.WriteStatusLine(statusCode)
+			_ = w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+			_, _ = w.WriteBody(body)
+		},
+	}
+	out := exchange(t, s, "GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.True(t, strings.HasSuffix(out, "<h1>custom</h1>"))
+	assert.Equal(t, response.StatusCodeBadRequest, gotStatus)
+	assert.ErrorIs(t, gotErr, headers.ErrInvalidFieldName)
+
+	// Test: A client closing the connection between requests is not an error
+	called := false
+	s = &Server{
+		handler: targetHandler,
+		errorHandler: func(w *response.Writer, statusCode response.StatusCode, err error) {
+			called = true
+		},
+	}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.False(t, called)
+	// Test: An error handler that writes nothing still answers with the status
+	s = &Server{
+		handler:      targetHandler,
+		errorHandler: func(w *response.Writer, statusCode response.StatusCode, err error) {},
+	}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 0\r\n\r\n", withoutDate(out))
+
+	// Test: A panicking error handler drops the response and the connection
+	s = &Server{
+		handler: func(w *response.Writer, req *request.Request) { panic("boom") },
+		errorHandler: func(w *response.Writer, statusCode response.StatusCode, err error) {
+			_ = w.WriteStatusLine(statusCode)
+			panic("error handler boom")
+		},
+	}
+	assert.Equal(t, "", exchange(t, s, "GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n"))
+	assert.Equal(t, "", exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+}
+
+func TestAutoFramedResponses(t *testing.T) {
+	// Test: Automatically framed responses keep the connection open
+	s := &Server{handler: func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if req.Target.Path == "/large" {
+			_, _ = w.Write([]byte(strings.Repeat("x", 5000)))
+			return
+		}
+		_, _ = io.WriteString(w, req.Target.Path)
+	}}
+	out := exchange(t, s, "GET /small HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /large HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /nothing HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, 3, strings.Count(out, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, out, "Content-Length: 6\r\n\r\n/small")
+	assert.Contains(t, out, "Transfer-Encoding: chunked\r\n\r\n1388\r\n")
+	assert.Contains(t, out, "\r\n0\r\n\r\nHTTP/1.1 200 OK")
+	assert.True(t, strings.HasSuffix(out, "Content-Length: 8\r\n\r\n/nothing"))
+
+	// Test: Date is always sent, Server only when configured
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Regexp(t, `\r\nDate: \w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT\r\n`, out)
+	assert.NotContains(t, out, "Server:")
+	s = &Server{handler: targetHandler, serverHeader: "httpfromtcp"}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "\r\nServer: httpfromtcp\r\n")
+
+	// Test: Handlers that write nothing get an empty 200
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {}}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 0\r\n\r\n", withoutDate(out))
+}
+
+func TestFramingErrors(t *testing.T) {
+	// Test: Content-Length with Transfer-Encoding is answered with 400
+	called := false
+	s := &Server{handler: func(w *response.Writer, req *request.Request) {
+		called = true
+	}}
+	out := exchange(t, s, "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nGET /smuggled HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+	assert.False(t, called)
+
+	// Test: Unknown transfer coding is answered with 501
+	s = &Server{handler: targetHandler}
+	out = exchange(t, s, "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 501 Not Implemented\r\n"))
+}
+
+func TestMiddleware(t *testing.T) {
+	// Test: Chain runs the first middleware outermost
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" before")
+				next(w, req)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	handler := Chain(trace("outer"), trace("inner"))(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	})
+	handler(response.NewWriter(io.Discard), nil)
+	assert.Equal(t, []string{"outer before", "inner before", "handler", "inner after", "outer after"}, calls)
+
+	// Test: An empty chain returns the handler unchanged
+	calls = nil
+	Chain()(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+	})(response.NewWriter(io.Discard), nil)
+	assert.Equal(t, []string{"handler"}, calls)
+
+	// Test: Middleware sees the status and size of the response
+	var status response.StatusCode
+	var written int
+	inspect := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			status, written = w.Status(), w.BytesWritten()
+		}
+	}
+	s := &Server{handler: Chain(inspect)(func(w *response.Writer, req *request.Request) {
+		w.SetStatus(response.StatusCodeAccepted)
+		_, _ = io.WriteString(w, "queued")
+	})}
+	out := exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 202 Accepted\r\n"))
+	assert.Equal(t, response.StatusCodeAccepted, status)
+	assert.Equal(t, 6, written)
+}
+
+func TestHandlerPanics(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// Test: A panic before the status line is answered with 500
+	s := &Server{handler: func(w *response.Writer, req *request.Request) {
+		w.Header().Set("X-Partial", "yes")
+		_, _ = io.WriteString(w, "partial")
+		panic("boom")
+	}}
+	out := exchange(t, s, "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: 22\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"Internal Server Error\n", withoutDate(out))
+	assert.Contains(t, logs.String(), "panic serving GET /one: boom\n")
+	assert.Contains(t, logs.String(), "goroutine ")
+
+	// Test: The error handler receives ErrHandlerPanic
+	var gotStatus response.StatusCode
+	var gotErr error
+	s.errorHandler = func(w *response.Writer, statusCode response.StatusCode, err error) {
+		gotStatus, gotErr = statusCode, err
+		_, _ = io.WriteString(w, "sorry")
+	}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nsorry"))
+	assert.Equal(t, response.StatusCodeInternalServerError, gotStatus)
+	assert.ErrorIs(t, gotErr, ErrHandlerPanic)
+	assert.ErrorContains(t, gotErr, "boom")
+
+	// Test: A response still in the buffer is replaced by the 500
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		_ = w.WriteStatusLine(response.StatusCodeOK)
+		_ = w.WriteHeaders(response.GetDefaultHeaders(10))
+		_, _ = w.WriteBody([]byte("hello"))
+		panic("boom")
+	}}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, out, "200 OK")
+	assert.NotContains(t, out, "hello")
+
+	// Test: A panic after part of the response was sent aborts the connection
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		_ = w.WriteStatusLine(response.StatusCodeOK)
+		_ = w.WriteHeaders(response.GetDefaultHeaders(10))
+		_, _ = w.WriteBody([]byte("hello"))
+		_ = w.Flush()
+		_, _ = w.WriteBody([]byte("unflushed"))
+		panic("boom")
+	}}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"+
+		"GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 10\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello", withoutDate(out))
+
+	// Test: A chunked body is left unterminated
+	s = &Server{handler: func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Transfer-Encoding", "chunked")
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 5000))
+		_ = w.Flush()
+		panic("boom")
+	}}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\r\n"))
+	assert.NotContains(t, out, "\r\n0\r\n")
+	assert.NotContains(t, out, "500")
+
+	// Test: Panics in middleware are recovered too
+	s = &Server{handler: Chain(func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			panic(errors.New("middleware failed"))
+		}
+	})(targetHandler)}
+	out = exchange(t, s, "GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 500 Internal Server Error\r\n"))
+}
+
+func TestTimeouts(t *testing.T) {
+	timeout := 50 * time.Millisecond
+
+	// Test: Slow request headers are answered with 408
+	s := &Server{handler: targetHandler, timeouts: Timeouts{ReadHeaderTimeout: timeout}}
+	out := exchange(t, s, "GET / HTTP/1.1\r\nHost: local")
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout\r\n"+
+		"Connection: close\r\n"+
+		"Content-Length: 16\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"Request Timeout\n", withoutDate(out))
+
+	// Test: ReadTimeout also bounds the headers when ReadHeaderTimeout is unset
+	s = &Server{handler: targetHandler, timeouts: Timeouts{ReadTimeout: timeout}}
+	out = exchange(t, s, "GET / HTTP/1.1\r\n")
+	assert.True(t, strings.HasPrefix(out, "HTTP/1.1 408 Request Timeout\r\n"))
+
+	// Test: A connection that never sends anything is closed silently
+	s = &Server{handler: targetHandler, timeouts: Timeouts{ReadHeaderTimeout: timeout}}
+	assert.Equal(t, "", exchange(t, s, ""))
+
+	// Test: An idle kept-alive connection is closed silently
+	s = &Server{handler: targetHandler, timeouts: Timeouts{ReadHeaderTimeout: time.Minute, IdleTimeout: timeout}}
+	out = exchange(t, s, "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n/one"))
+	assert.Equal(t, 1, strings.Count(out, "HTTP/1.1"))
+
+	// Test: Idle periods longer than ReadHeaderTimeout are bounded by IdleTimeout
+	s = &Server{handler: targetHandler, timeouts: Timeouts{ReadHeaderTimeout: timeout, IdleTimeout: time.Minute}}
+	client, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.handle(conn)
+		close(done)
+	}()
+	clientReader := bufio.NewReader(client)
+	for i, target := range []string{"/one", "/two"} {
+		if i > 0 {
+			time.Sleep(2 * timeout)
+		}
+		_, err := client.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(readResponse(t, clientReader), "\r\n\r\n"+target))
+	}
+	client.Close()
+	<-done
+
+	// Test: ReadTimeout bounds reading the body
+	var bodyErr error
+	s = &Server{
+		handler: func(w *response.Writer, req *request.Request) {
+			_, bodyErr = req.BodyBytes()
+		},
+		timeouts: Timeouts{ReadHeaderTimeout: time.Minute, ReadTimeout: timeout},
+	}
+	exchange(t, s, "POST / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\nConnection: close\r\n\r\nhello")
+	assert.ErrorIs(t, bodyErr, os.ErrDeadlineExceeded)
+
+	// Test: WriteTimeout stops writing to a client that does not read
+	s = &Server{
+		handler: func(w *response.Writer, req *request.Request) {
+			_, _ = w.Write(bytes.Repeat([]byte("x"), 1<<20))
+		},
+		timeouts: Timeouts{WriteTimeout: timeout},
+	}
+	client, conn = net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		s.handle(conn)
+		close(done)
+	}()
+	_, err := client.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not stopped by the write timeout")
+	}
+	client.Close()
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		if req.Target.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+		targetHandler(w, req)
+	})
+	require.NoError(t, err)
+	address := s.listener.Addr().String()
+	hookCalled := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hookCalled) })
+
+	// an idle kept-alive connection
+	idle, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer idle.Close()
+	_, err = idle.Write([]byte("GET /idle HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	idleReader := bufio.NewReader(idle)
+	assert.True(t, strings.HasSuffix(readResponse(t, idleReader), "/idle"))
+
+	// a connection with a request in flight
+	active, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer active.Close()
+	_, err = active.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- s.Shutdown(context.Background())
+	}()
+
+	// Test: Shutdown runs the registered hooks
+	select {
+	case <-hookCalled:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown hook was not called")
+	}
+
+	// Test: Idle connections are closed
+	_, err = idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	if conn, err := net.Dial("tcp", address); err == nil {
+		_, err = conn.Read(make([]byte, 1))
+		assert.Error(t, err)
+		conn.Close()
+	}
+
+	// Test: Shutdown waits for active requests, then closes their connections
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("shutdown returned before the active request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	out, err := io.ReadAll(active)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(out), "/slow"))
+	select {
+	case err := <-shutdownDone:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not return after the active request finished")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		w.Header().Set("Content-Length", "10")
+		_, _ = io.WriteString(w, "hello")
+		close(started)
+		<-release
+	})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	// Test: Connections still active when the context expires are closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	out, _ := io.ReadAll(conn)
+	assert.NotContains(t, string(out), "hello")
+}
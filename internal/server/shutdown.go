@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether the active
+// connections have finished.
+const shutdownPollInterval = 10 * time.Millisecond
+
+type connState int
+
+const (
+	// stateIdle is a connection waiting for the first byte of a request.
+	stateIdle connState = 0
+	// stateActive is a connection with a request in flight.
+	stateActive connState = 1
+)
+
+// trackConn starts tracking a newly accepted connection as idle. It reports
+// false once Shutdown has started, when the connection must be closed instead.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connState)
+	}
+	s.conns[conn] = stateIdle
+	return true
+}
+
+func (s *Server) setConnState(conn net.Conn, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connState)
+	}
+	s.conns[conn] = state
+}
+
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// RegisterOnShutdown registers f to be called when Shutdown starts, such as
+// to tell long-running handlers to wrap up. Each function runs in its own
+// goroutine, and Shutdown does not wait for them.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Shutdown stops the server gracefully. It closes the listener, runs the
+// functions registered with RegisterOnShutdown, and closes every idle
+// connection. Connections with a request in flight are closed once their
+// response is finished, and requests whose headers are read after Shutdown
+// starts are answered with Connection: close. Shutdown returns when all
+// connections are closed, or when ctx is done, in which case the remaining
+// connections are closed forcibly and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	s.closed.Store(true)
+	var err error
+	if closeErr := s.listener.Close(); closeErr != nil {
+		err = fmt.Errorf("failed to close listener: %w", closeErr)
+	}
+
+	s.mu.Lock()
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes the connections that have no request in flight and
+// reports whether none are left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if state == stateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) closeAllConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
@@ -0,0 +1,45 @@
+package server
+
+import "time"
+
+// Timeouts bound how long a connection may take at each stage. A zero value
+// means no limit.
+type Timeouts struct {
+	// ReadHeaderTimeout is how long a client has to send the request line and
+	// headers, from its first byte, or from accepting a new connection. A
+	// client that runs out of time is answered with 408. It defaults to
+	// ReadTimeout.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is how long a client has to send a whole request, including
+	// its body, measured like ReadHeaderTimeout.
+	ReadTimeout time.Duration
+	// WriteTimeout is how long the server has to write the response, from the
+	// end of the request headers.
+	WriteTimeout time.Duration
+	// IdleTimeout is how long a kept-alive connection may wait for the next
+	// request before it is closed. It defaults to ReadTimeout.
+	IdleTimeout time.Duration
+}
+
+func (t Timeouts) readHeader() time.Duration {
+	if t.ReadHeaderTimeout == 0 {
+		return t.ReadTimeout
+	}
+	return t.ReadHeaderTimeout
+}
+
+func (t Timeouts) idle() time.Duration {
+	if t.IdleTimeout == 0 {
+		return t.ReadTimeout
+	}
+	return t.IdleTimeout
+}
+
+// deadline returns the time timeout after start, or the zero time, which
+// clears a deadline, if there is no timeout.
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}